@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"github.com/joshrwolf/apko-shell/internal/builder"
+	"github.com/joshrwolf/apko-shell/internal/caches"
+	"github.com/joshrwolf/apko-shell/internal/runtime"
+	"github.com/spf13/cobra"
+)
+
+// newCacheCmd creates the cache command and its subcommands
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage persistent tool caches",
+	}
+
+	cmd.AddCommand(
+		newCacheListCmd(),
+		newCacheRemoveCmd(),
+		newCachePresetsCmd(),
+	)
+
+	return cmd
+}
+
+func newCacheListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List caches",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openCaches()
+			if err != nil {
+				return err
+			}
+
+			entries, err := store.List()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSIZE\tPATH")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", e.Name, humanSize(e.Size), e.Path)
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
+func newCacheRemoveCmd() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:     "rm NAME...",
+		Aliases: []string{"remove"},
+		Short:   "Remove caches",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !all && len(args) == 0 {
+				return fmt.Errorf("specify cache names or --all")
+			}
+
+			store, err := openCaches()
+			if err != nil {
+				return err
+			}
+
+			names := args
+			if all {
+				entries, err := store.List()
+				if err != nil {
+					return err
+				}
+				names = nil
+				for _, e := range entries {
+					names = append(names, e.Name)
+				}
+			}
+
+			for _, name := range names {
+				if err := store.Remove(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Remove every cache")
+
+	return cmd
+}
+
+func newCachePresetsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "presets",
+		Short: "List built-in cache presets",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "PRESET\tCACHES")
+			for _, name := range caches.Presets() {
+				mounts, _ := caches.Preset(name)
+				var specs []string
+				for _, m := range mounts {
+					specs = append(specs, m.Name+":"+m.Target)
+				}
+				fmt.Fprintf(w, "%s\t%s\n", name, strings.Join(specs, " "))
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
+// openCaches returns the store for persistent tool caches
+func openCaches() (*caches.Store, error) {
+	cacheDir, err := userCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return caches.NewStore(filepath.Join(cacheDir, "caches")), nil
+}
+
+// resolveCacheMounts maps cache specs to host directories and prepares
+// their mount points in the image. The host directories are only created
+// with create set.
+func resolveCacheMounts(imageConfig *types.ImageConfiguration, specs []string, create bool) ([]runtime.Mount, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	store, err := openCaches()
+	if err != nil {
+		return nil, err
+	}
+
+	u := builder.HostUser()
+
+	var mounts []runtime.Mount
+	for _, spec := range specs {
+		parsed, err := caches.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range parsed {
+			target := m.Path(u.Home)
+			if slices.ContainsFunc(mounts, func(existing runtime.Mount) bool { return existing.Target == target }) {
+				continue
+			}
+
+			dir, err := store.Path(m.Name)
+			if create {
+				dir, err = store.Dir(m.Name)
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			builder.AddDirectory(imageConfig, target, u)
+			mounts = append(mounts, runtime.Mount{Source: dir, Target: target})
+		}
+	}
+
+	return mounts, nil
+}
+
+// humanSize formats a byte count for display
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
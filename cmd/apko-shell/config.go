@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/joshrwolf/apko-shell/internal/builder"
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/script"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// resolution is the fully merged configuration of a run
+type resolution struct {
+	*config.Resolved
+
+	// Parsed script, nil without one
+	Script *script.Config
+}
+
+// parseFlagLayer parses args as apko-shell flags into a layer
+func parseFlagLayer(source string, args []string) (config.Layer, error) {
+	o := &options{}
+	fs := pflag.NewFlagSet(source, pflag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(&o.logLevel, "log-level", "")
+	o.addFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return config.Layer{}, err
+	}
+	return layerFromFlags(source, fs, o), nil
+}
+
+// parseShebang parses the arguments of the script's #!apko-shell lines
+// into one layer per line, so that errors point at the line at fault
+func parseShebang(cfg *script.Config) ([]config.Layer, error) {
+	var layers []config.Layer
+	for i := 0; i < len(cfg.ShebangTokens); {
+		line := cfg.ShebangTokens[i].Line
+
+		var args []string
+		for ; i < len(cfg.ShebangTokens) && cfg.ShebangTokens[i].Line == line; i++ {
+			args = append(args, cfg.ShebangTokens[i].Value)
+		}
+
+		l, err := parseFlagLayer(config.SourceShebang, args)
+		if err != nil {
+			return nil, &script.Error{Line: line, Msg: err.Error()}
+		}
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+// layerFromFlags collects the flags explicitly set in fs
+func layerFromFlags(source string, fs *pflag.FlagSet, o *options) config.Layer {
+	l := config.Layer{Source: source}
+	if fs.Changed("packages") {
+		l.Packages = o.packages
+	}
+	if fs.Changed("shell") {
+		l.Shell = o.shell
+	}
+	if fs.Changed("publish") {
+		l.Ports = o.publish
+	}
+	if fs.Changed("cache-mount") {
+		l.Caches = o.caches
+	}
+	if fs.Changed("output-dir") {
+		l.OutputDir = o.outputDir
+	}
+	if fs.Changed("interpreter") {
+		l.Interpreter = o.interpreter
+	}
+	if fs.Changed("secret") {
+		l.Secrets = o.secrets
+	}
+	if fs.Changed("workdir") {
+		l.WorkDir = o.workDir
+	}
+	if fs.Changed("command") {
+		l.Command = o.command
+	}
+	if fs.Changed("log-level") {
+		l.LogLevel = o.logLevel.String()
+	}
+
+	l.SSH = changedBool(fs, "ssh", o.ssh)
+	l.GitConfig = changedBool(fs, "git-config", o.gitConfig)
+	l.NoWorkDir = changedBool(fs, "no-workdir", o.noWorkDir)
+	l.MountRepo = changedBool(fs, "mount-repo", o.mountRepo)
+	l.Sandbox = changedBool(fs, "sandbox", o.sandbox)
+	l.SandboxOverlay = changedBool(fs, "sandbox-overlay", o.overlay)
+	l.Auto = changedBool(fs, "auto", o.auto)
+	l.CommandNotFound = changedBool(fs, "command-not-found", o.notFound)
+	l.Interactive = changedBool(fs, "interactive", o.interactive)
+	l.BuildOnly = changedBool(fs, "build-only", o.buildOnly)
+	l.DryRun = changedBool(fs, "dry-run", o.dryRun)
+	l.JSON = changedBool(fs, "json", o.json)
+	l.Offline = changedBool(fs, "offline", o.offline)
+	return l
+}
+
+// changedBool returns v if the flag name was set in fs, and nil otherwise
+func changedBool(fs *pflag.FlagSet, name string, v bool) *bool {
+	if !fs.Changed(name) {
+		return nil
+	}
+	return &v
+}
+
+// resolve merges the defaults, user and project config, the script at
+// scriptPath (if any), its shebang arguments and flags. The image has no
+// account for the host user yet, see addHostUser.
+func (o *options) resolve(ctx context.Context, scriptPath string, flags config.Layer) (*resolution, error) {
+	dir := "."
+	if scriptPath != "" {
+		dir = filepath.Dir(scriptPath)
+	}
+
+	user, err := config.LoadUser()
+	if err != nil {
+		return nil, err
+	}
+	project, err := config.LoadProject(dir)
+	if err != nil {
+		return nil, err
+	}
+	layers := []config.Layer{user, project}
+
+	res := &resolution{}
+	var scriptLayer int
+	if scriptPath != "" {
+		cfg, err := script.ParseFile(scriptPath)
+		if err != nil {
+			return nil, fmt.Errorf("parsing script: %w", err)
+		}
+		res.Script = cfg
+		scriptLayer = len(layers)
+
+		shebang, err := parseShebang(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("parsing script: %w", err)
+		}
+		layers = append(layers, config.ScriptLayer(cfg, scriptPath))
+		layers = append(layers, shebang...)
+	}
+	layers = append(layers, flags)
+
+	if res.Script != nil {
+		res.Resolved = config.Resolve(res.Script.ImageConfig, layers...)
+
+		// The script's Python depends on the resolved repositories, so
+		// resolve again once it is known
+		if selected, err := selectPython(ctx, res); err != nil {
+			return nil, err
+		} else if selected {
+			layers[scriptLayer] = config.ScriptLayer(res.Script, scriptPath)
+			res.Resolved = config.Resolve(res.Script.ImageConfig, layers...)
+		}
+	} else {
+		res.Resolved = config.Resolve(nil, layers...)
+	}
+
+	// Scripts run under --interpreter, then whatever the script implies,
+	// then the shell; make sure the interpreter is installed. Commands
+	// given with -c are shell commands.
+	if len(res.Interpreter) == 0 && res.Script != nil && res.Command == "" {
+		res.Interpreter = res.Script.Interpreter(scriptPath)
+	}
+	if len(res.Interpreter) == 0 {
+		res.Interpreter = []string{res.Shell}
+	}
+	if pkg, ok := script.InterpreterPackage(res.Interpreter[0]); ok {
+		res.AddPackages("interpreter", pkg)
+	}
+
+	addShellPackage(res.Resolved)
+	return res, nil
+}
+
+// selectPython chooses the Python of a script with requires-python among
+// the release lines packaged in the resolved repositories. It reports
+// whether one was chosen: offline, or when the repository indexes can't be
+// read, the script gets python3.
+func selectPython(ctx context.Context, res *resolution) (bool, error) {
+	log := clog.FromContext(ctx)
+
+	py := res.Script.Python
+	if py == nil || py.RequiresPython == "" {
+		return false, nil
+	}
+	if res.Offline {
+		log.Warn("not looking up a Python satisfying requires-python offline, using python3", "requires-python", py.RequiresPython)
+		return false, nil
+	}
+
+	cacheDir, tmpDir, err := workDirs()
+	if err != nil {
+		return false, err
+	}
+	pkgs, err := builder.New(cacheDir, tmpDir).Index(ctx, res.Image)
+	if err != nil {
+		log.Warn("could not look up a Python satisfying requires-python, using python3", "error", err)
+		return false, nil
+	}
+
+	names := make([]string, len(pkgs))
+	for i, p := range pkgs {
+		names[i] = p.Name
+	}
+	if err := py.SelectPython(names); err != nil {
+		return false, fmt.Errorf("script: %w", err)
+	}
+	return true, nil
+}
+
+// addShellPackage installs the package providing the resolved shell
+func addShellPackage(res *config.Resolved) {
+	if shellPkg, ok := script.InterpreterPackage(res.Shell); ok {
+		res.AddPackages("shell", shellPkg)
+	}
+}
+
+// addHostUser gives the host user, which containers run as, a passwd entry
+// and a writable home directory. Images meant to be shared, such as
+// exported ones, go without.
+func addHostUser(res *config.Resolved) {
+	builder.AddUser(res.Image, builder.HostUser(), res.Shell)
+}
+
+// newConfigCmd creates the config command and its subcommands
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect apko-shell configuration",
+	}
+
+	cmd.AddCommand(newConfigResolveCmd())
+
+	return cmd
+}
+
+func newConfigResolveCmd() *cobra.Command {
+	opts := &options{}
+
+	cmd := &cobra.Command{
+		Use:   "resolve [script]",
+		Short: "Print the merged image configuration and where each value came from",
+		Long: `Print the merged image configuration and where each value came from.
+
+Configuration is merged from, lowest precedence first: built-in defaults,
+the user config (` + "`config.yaml`" + ` in the apko-shell config directory), the
+nearest ` + config.ProjectFile + ` up to the repository root, the script's
+blocks, its #!apko-shell arguments, then flags given here. Lists such as
+packages and secrets accumulate without duplicates; every other setting,
+such as the shell, working directory, --sandbox or each environment
+variable, takes the highest precedence value. Only the user config and
+flags can turn --sandbox off once it is on.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var scriptPath string
+			if len(args) > 0 {
+				scriptPath = args[0]
+			}
+
+			res, err := opts.resolve(cmd.Context(), scriptPath, layerFromFlags(config.SourceFlags, cmd.Flags(), opts))
+			if err != nil {
+				return err
+			}
+			addHostUser(res.Resolved)
+
+			out, err := yaml.Marshal(res.Image)
+			if err != nil {
+				return fmt.Errorf("marshaling configuration: %w", err)
+			}
+			fmt.Print(string(out))
+
+			fmt.Println()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "FIELD\tVALUE\tSOURCE")
+			for _, o := range res.Origins {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", o.Field, o.Value, o.Source)
+			}
+			return w.Flush()
+		},
+	}
+
+	opts.addFlags(cmd.Flags())
+
+	return cmd
+}
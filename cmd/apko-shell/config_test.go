@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/script"
+)
+
+func TestParseShebang(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		packages []string
+		wantLine int
+		wantErr  string
+	}{
+		{
+			name:     "one layer per line",
+			header:   "#!/usr/bin/env apko-shell\n#!apko-shell -p jq --sandbox\n#!apko-shell -p 'curl'\n",
+			packages: []string{"jq", "curl"},
+		},
+		{
+			name:     "unknown flag",
+			header:   "#!/usr/bin/env apko-shell\n#!apko-shell -p jq\n#!apko-shell --pakages curl\n",
+			wantLine: 3,
+			wantErr:  "unknown flag: --pakages",
+		},
+		{
+			name:     "invalid value",
+			header:   "#!/usr/bin/env apko-shell\n#!apko-shell --sandbox=maybe\n",
+			wantLine: 2,
+			wantErr:  "--sandbox",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.sh")
+			if err := os.WriteFile(path, []byte(tt.header+"echo hi\n"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := script.ParseFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			layers, err := parseShebang(cfg)
+			if tt.wantErr != "" {
+				var serr *script.Error
+				if !errors.As(err, &serr) || serr.Line != tt.wantLine || !strings.Contains(serr.Msg, tt.wantErr) {
+					t.Fatalf("parseShebang() error = %v, want line %d: %s", err, tt.wantLine, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseShebang() error = %v", err)
+			}
+
+			var packages []string
+			for _, l := range layers {
+				packages = append(packages, l.Packages...)
+			}
+			if strings.Join(packages, " ") != strings.Join(tt.packages, " ") {
+				t.Errorf("packages = %v, want %v", packages, tt.packages)
+			}
+		})
+	}
+}
+
+func TestResolvePrecedence(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	writeFile(t, filepath.Join(configHome, "apko-shell", "config.yaml"), `shell: /bin/bash
+packages: [git]
+sandbox: true
+environment:
+  EDITOR: vi
+  LANG: C
+`)
+
+	// A repository with a project config above the script's directory
+	repo := t.TempDir()
+	if err := os.Mkdir(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(repo, config.ProjectFile), `shell: /bin/zsh
+packages: [make]
+workdir: tools
+environment:
+  LANG: C.UTF-8
+`)
+	path := filepath.Join(repo, "scripts", "build.sh")
+	writeFile(t, path, `#!/usr/bin/env apko-shell
+#!apko-shell -p jq --sandbox=false
+#!apko-shell --shell /bin/ash
+# /// apko
+# contents:
+#   packages: [curl]
+# ///
+echo hi
+`)
+
+	no := false
+	tests := []struct {
+		name    string
+		flags   config.Layer
+		shell   string
+		sandbox string
+	}{
+		{
+			name:    "script over config",
+			flags:   config.Layer{Source: config.SourceFlags},
+			shell:   "/bin/ash shebang",
+			sandbox: "true " + config.SourceUser,
+		},
+		{
+			name:    "flags over script",
+			flags:   config.Layer{Source: config.SourceFlags, Shell: "/bin/dash", Sandbox: &no},
+			shell:   "/bin/dash flags",
+			sandbox: "false flags",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := (&options{}).resolve(context.Background(), path, tt.flags)
+			if err != nil {
+				t.Fatalf("resolve() error = %v", err)
+			}
+
+			origins := map[string]string{}
+			for _, o := range res.Origins {
+				origins[o.Field] = o.Value + " " + o.Source
+				if o.Field == "environment" {
+					origins[o.Value] = o.Source
+				}
+			}
+			if got := origins["shell"]; got != tt.shell {
+				t.Errorf("shell = %q, want %q", got, tt.shell)
+			}
+			if got := origins["sandbox"]; !strings.HasPrefix(got, tt.sandbox) {
+				t.Errorf("sandbox = %q, want %q", got, tt.sandbox)
+			}
+
+			// Lists accumulate in precedence order
+			if got := strings.Join(res.Image.Contents.Packages, " "); !strings.HasPrefix(got, "git make curl jq") {
+				t.Errorf("packages = %q, want git make curl jq first", got)
+			}
+			if res.WorkDir != filepath.Join(repo, "tools") {
+				t.Errorf("workdir = %q, want it relative to the project config", res.WorkDir)
+			}
+			if !strings.HasPrefix(origins["LANG=C.UTF-8"], config.SourceProject) || !strings.HasPrefix(origins["EDITOR=vi"], config.SourceUser) {
+				t.Errorf("environment origins = %v", origins)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
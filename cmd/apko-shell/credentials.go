@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/joshrwolf/apko-shell/internal/runtime"
+)
+
+// credentialMounts returns the mounts that forward the host's SSH agent
+// and git configuration into the container
+func credentialMounts(ctx context.Context, ssh, gitConfig bool) ([]runtime.Mount, error) {
+	log := clog.FromContext(ctx)
+
+	var mounts []runtime.Mount
+
+	if ssh {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, fmt.Errorf("--ssh requires a running SSH agent (SSH_AUTH_SOCK is not set)")
+		}
+		mounts = append(mounts, runtime.Mount{
+			Type:   runtime.MountSSHAgent,
+			Source: sock,
+			Target: runtime.SSHAgentSocketPath,
+		})
+	}
+
+	if gitConfig {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("getting home dir: %w", err)
+		}
+
+		files := []struct {
+			mountType runtime.MountType
+			source    string
+			target    string
+		}{
+			{runtime.MountGitConfig, filepath.Join(home, ".gitconfig"), runtime.GitConfigPath},
+			{runtime.MountBind, filepath.Join(home, ".ssh", "known_hosts"), runtime.KnownHostsPath},
+		}
+		for _, f := range files {
+			if _, err := os.Stat(f.source); err != nil {
+				log.Debug("not forwarding missing file", "path", f.source)
+				continue
+			}
+			mounts = append(mounts, runtime.Mount{
+				Type:     f.mountType,
+				Source:   f.source,
+				Target:   f.target,
+				ReadOnly: true,
+			})
+		}
+	}
+
+	return mounts, nil
+}
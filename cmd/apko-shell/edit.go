@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/joshrwolf/apko-shell/internal/builder"
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/script"
+	"github.com/spf13/cobra"
+)
+
+func newAddCmd() *cobra.Command {
+	var lock bool
+
+	cmd := &cobra.Command{
+		Use:   "add SCRIPT PACKAGE...",
+		Short: "Add packages to a script's header",
+		Long: `Add packages to a script's header, editing its #!apko-shell -p line or
+the packages list of its apko block in place. Packages already declared
+are replaced, so "add SCRIPT jq=1.7.1-r0" pins jq.
+
+With --lock, every package the script declares is pinned to the version
+it currently resolves to.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editScript(cmd.Context(), args[0], args[1:], nil, lock)
+		},
+	}
+
+	cmd.Flags().BoolVar(&lock, "lock", false, "Pin the script's packages to their currently resolved versions")
+
+	return cmd
+}
+
+func newRemoveCmd() *cobra.Command {
+	var lock bool
+
+	cmd := &cobra.Command{
+		Use:     "remove SCRIPT PACKAGE...",
+		Aliases: []string{"rm"},
+		Short:   "Remove packages from a script's header",
+		Long: `Remove packages from a script's header, wherever it declares them:
+its #!apko-shell -p lines and the packages list of its apko block.
+
+With --lock, the remaining packages are pinned to the versions they
+currently resolve to.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editScript(cmd.Context(), args[0], nil, args[1:], lock)
+		},
+	}
+
+	cmd.Flags().BoolVar(&lock, "lock", false, "Pin the script's packages to their currently resolved versions")
+
+	return cmd
+}
+
+// editScript adds and removes the packages declared by the script at path.
+// The edited script is written next to it and only replaces it once it
+// parsed, and with lock, resolved.
+func editScript(ctx context.Context, path string, add, remove []string, lock bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("reading script: %w", err)
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading script: %w", err)
+	}
+
+	comment := script.CommentPrefix(path)
+	edited, err := script.EditPackages(src, comment, add, remove)
+	if err != nil {
+		return err
+	}
+
+	// Keep the extension, and so the conventions that go with it
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".apko-shell-edit-*"+filepath.Ext(path))
+	if err != nil {
+		return fmt.Errorf("creating temp script: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing temp script: %w", err)
+	}
+	if err := os.WriteFile(tmp.Name(), edited, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("writing script: %w", err)
+	}
+
+	if lock {
+		edited, err = lockPackages(ctx, tmp.Name(), comment, edited, add)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(tmp.Name(), edited, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("writing script: %w", err)
+		}
+	}
+
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("writing script: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing script: %w", err)
+	}
+	return nil
+}
+
+// lockPackages pins the packages declared by src, written at path, to the
+// versions they resolve to. Existing pins are refreshed, except those just
+// requested in add.
+func lockPackages(ctx context.Context, path, comment string, src []byte, add []string) ([]byte, error) {
+	declared, err := declaredPackages(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(declared) == 0 {
+		return src, nil
+	}
+
+	var unpinned []string
+	for _, spec := range declared {
+		if name := script.PackageName(spec); name != spec && !slices.Contains(add, spec) {
+			unpinned = append(unpinned, name)
+		}
+	}
+
+	// Resolve stale pins afresh
+	if len(unpinned) > 0 {
+		if src, err = script.EditPackages(src, comment, unpinned, nil); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, src, 0o600); err != nil {
+			return nil, fmt.Errorf("writing script: %w", err)
+		}
+	}
+
+	opts := &options{}
+	res, err := opts.resolve(ctx, path, config.Layer{Source: config.SourceFlags})
+	if err != nil {
+		return nil, err
+	}
+
+	cacheDir, tmpDir, err := workDirs()
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := builder.New(cacheDir, tmpDir).Resolve(ctx, res.Image)
+	if err != nil {
+		return nil, fmt.Errorf("resolving packages: %w", err)
+	}
+
+	versions := map[string]string{}
+	for _, p := range pkgs {
+		versions[p.Name] = p.Version
+	}
+
+	var pins []string
+	for _, spec := range declared {
+		name := script.PackageName(spec)
+		v, ok := versions[name]
+		if !ok || (name != spec && slices.Contains(add, spec)) {
+			continue
+		}
+		pins = append(pins, name+"="+v)
+	}
+	return script.EditPackages(src, comment, pins, nil)
+}
+
+// declaredPackages returns the packages the header of the script at path
+// declares, in its #!apko-shell lines and apko block
+func declaredPackages(path string) ([]string, error) {
+	cfg, err := script.ParseFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("parsing script: %w", err)
+	}
+
+	shebang, err := parseShebang(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("parsing script: %w", err)
+	}
+
+	var declared []string
+	for _, l := range shebang {
+		declared = append(declared, l.Packages...)
+	}
+	if cfg.ImageConfig != nil {
+		declared = append(declared, cfg.ImageConfig.Contents.Packages...)
+	}
+	return declared, nil
+}
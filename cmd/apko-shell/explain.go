@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/joshrwolf/apko-shell/internal/builder"
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/runtime"
+	"github.com/spf13/cobra"
+)
+
+// explainImage stands in for the loaded image in the described command
+const explainImage = "apko-shell:latest"
+
+// explanation describes what a run would do
+type explanation struct {
+	Script           string            `json:"script,omitempty"`
+	Command          string            `json:"command,omitempty"`
+	Shell            string            `json:"shell"`
+	Interpreter      []string          `json:"interpreter"`
+	Requested        []string          `json:"requested"`
+	Packages         []builder.Package `json:"packages,omitempty"`
+	ResolveError     string            `json:"resolveError,omitempty"`
+	Repositories     []string          `json:"repositories"`
+	Keyring          []string          `json:"keyring"`
+	Environment      map[string]string `json:"environment,omitempty"`
+	WorkDir          string            `json:"workdir,omitempty"`
+	ContainerWorkDir string            `json:"containerWorkdir,omitempty"`
+	Mounts           []explainedMount  `json:"mounts,omitempty"`
+	Ports            []string          `json:"ports,omitempty"`
+	Secrets          []string          `json:"secrets,omitempty"`
+	OutputDir        string            `json:"outputDir,omitempty"`
+	Invocation       []string          `json:"invocation,omitempty"`
+	InvocationError  string            `json:"invocationError,omitempty"`
+	Origins          []config.Origin   `json:"origins"`
+}
+
+// explainedMount is a host path exposed in the container
+type explainedMount struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+func newExplainCmd() *cobra.Command {
+	opts := &options{}
+
+	cmd := &cobra.Command{
+		Use:   "explain [script] [args...]",
+		Short: "Show the environment a run would create, without building it",
+		Long: `Show the environment a run would create, without building it: the
+resolved packages with their versions, repositories, shell, mounts,
+environment and the exact container runtime invocation.
+
+Accepts the same flags as a run. Package versions are resolved against the
+repository indexes; pass --offline to skip that.`,
+		Args: cobra.ArbitraryArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := layerFromFlags(config.SourceFlags, cmd.Flags(), opts)
+			dryRun := true
+			flags.DryRun = &dryRun
+
+			p, err := opts.plan(cmd.Context(), flags, args)
+			if err != nil {
+				return err
+			}
+			defer p.cleanup()
+			return p.explain(cmd.Context())
+		},
+	}
+
+	opts.addFlags(cmd.Flags())
+
+	return cmd
+}
+
+// explain prints what the planned run would do
+func (p *plan) explain(ctx context.Context) error {
+	log := clog.FromContext(ctx)
+
+	ex := &explanation{
+		Script:           p.scriptPath,
+		Command:          p.Command,
+		Shell:            p.Shell,
+		Interpreter:      p.Interpreter,
+		Requested:        p.Image.Contents.Packages,
+		Repositories:     p.Image.Contents.RuntimeRepositories,
+		Keyring:          p.Image.Contents.Keyring,
+		Environment:      p.Image.Environment,
+		WorkDir:          p.runOpts.WorkDir,
+		ContainerWorkDir: p.runOpts.ContainerWorkDir,
+		OutputDir:        p.runOpts.OutputDir,
+		Origins:          p.Origins,
+	}
+	// Interactive runs are set up like runInteractive does, but without
+	// writing the control directory's files
+	runOpts := p.runOpts
+	if p.Interactive {
+		controlDir := filepath.Join(os.TempDir(), "apko-shell-control-XXXX")
+		runOpts = interactiveRunOptions(p.resolution, controlDir, p.CommandNotFound, runOpts)
+	}
+
+	for _, m := range runOpts.Mounts {
+		ex.Mounts = append(ex.Mounts, explainedMount{Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly})
+	}
+	for _, pm := range p.runOpts.Ports {
+		ex.Ports = append(ex.Ports, pm.String())
+	}
+	for _, secret := range p.runOpts.Secrets {
+		from := "file " + secret.Source
+		if secret.Source == "" {
+			from = "$" + secret.Env
+		}
+		ex.Secrets = append(ex.Secrets, fmt.Sprintf("%s (from %s)", secret.Target(), from))
+	}
+
+	if !p.Offline {
+		cacheDir, tmpDir, err := workDirs()
+		if err != nil {
+			return err
+		}
+		pkgs, err := builder.New(cacheDir, tmpDir).Resolve(ctx, p.Image)
+		if err != nil {
+			log.Warn("could not resolve package versions", "error", err)
+			ex.ResolveError = err.Error()
+		}
+		sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+		ex.Packages = pkgs
+	}
+
+	rt, err := detectRuntime(ctx)
+	if err != nil {
+		ex.InvocationError = err.Error()
+	} else if d, ok := rt.(runtime.Describer); ok {
+		ex.Invocation = d.Describe(runOpts, explainImage)
+	} else {
+		ex.InvocationError = fmt.Sprintf("%T can't describe its invocation", rt)
+	}
+
+	if p.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ex)
+	}
+	return ex.print(os.Stdout)
+}
+
+// print writes the explanation for humans
+func (ex *explanation) print(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	if ex.Script != "" {
+		fmt.Fprintf(w, "Script:\t%s\n", ex.Script)
+	}
+	if ex.Command != "" {
+		fmt.Fprintf(w, "Command:\t%s\n", ex.Command)
+	}
+	fmt.Fprintf(w, "Interpreter:\t%s\n", strings.Join(ex.Interpreter, " "))
+	fmt.Fprintf(w, "Shell:\t%s\n", ex.Shell)
+	if ex.WorkDir != "" {
+		fmt.Fprintf(w, "Workspace:\t%s -> %s (starting in %s)\n", ex.WorkDir, runtime.WorkspacePath, ex.ContainerWorkDir)
+	}
+	if ex.OutputDir != "" {
+		fmt.Fprintf(w, "Outputs:\t%s -> %s\n", runtime.OutputPath, ex.OutputDir)
+	}
+
+	sources := map[string]string{}
+	for _, o := range ex.Origins {
+		if o.Field == "contents.packages" {
+			sources[o.Value] = o.Source
+		}
+	}
+
+	fmt.Fprintln(w)
+	if ex.Packages != nil {
+		fmt.Fprintf(w, "Packages (%d resolved):\n", len(ex.Packages))
+		fmt.Fprintln(w, "  NAME\tVERSION\tSIZE\tREQUESTED BY")
+		for _, pkg := range ex.Packages {
+			source := sources[pkg.Name]
+			if source == "" {
+				source = "dependency"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", pkg.Name, pkg.Version, humanSize(int64(pkg.Size)), source)
+		}
+	} else {
+		if ex.ResolveError != "" {
+			fmt.Fprintln(w, "Packages (versions could not be resolved):")
+		} else {
+			fmt.Fprintln(w, "Packages:")
+		}
+		fmt.Fprintln(w, "  NAME\tREQUESTED BY")
+		for _, name := range ex.Requested {
+			fmt.Fprintf(w, "  %s\t%s\n", name, sources[name])
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Repositories:")
+	for _, repo := range ex.Repositories {
+		fmt.Fprintf(w, "  %s\n", repo)
+	}
+
+	if len(ex.Mounts) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Mounts:")
+		for _, m := range ex.Mounts {
+			mode := "rw"
+			if m.ReadOnly {
+				mode = "ro"
+			}
+			fmt.Fprintf(w, "  %s\t-> %s\t%s\n", m.Source, m.Target, mode)
+		}
+	}
+
+	if len(ex.Ports) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Ports:")
+		for _, port := range ex.Ports {
+			fmt.Fprintf(w, "  %s\n", port)
+		}
+	}
+
+	if len(ex.Secrets) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Secrets:")
+		for _, secret := range ex.Secrets {
+			fmt.Fprintf(w, "  %s\n", secret)
+		}
+	}
+
+	if len(ex.Environment) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Environment:")
+		keys := make([]string, 0, len(ex.Environment))
+		for k := range ex.Environment {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "  %s=%s\n", k, ex.Environment[k])
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(ex.Invocation) > 0 {
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "Runtime invocation:")
+		fmt.Fprintf(out, "  %s\n", shellJoin(ex.Invocation))
+	} else if ex.InvocationError != "" {
+		fmt.Fprintln(out)
+		fmt.Fprintf(out, "Runtime invocation unknown: %s\n", ex.InvocationError)
+	}
+	return nil
+}
+
+// shellJoin quotes args for copying into a POSIX shell
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+/.,:@%") == "" {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/export"
+	"github.com/spf13/cobra"
+)
+
+func newExportCmd() *cobra.Command {
+	opts := &options{}
+	var (
+		format   string
+		output   string
+		imageRef string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export [script]",
+		Short: "Export a script's environment for other tooling",
+		Long: `Export the environment a script runs in, so it can be reused by other
+tooling:
+
+  apko          the resolved image configuration, as a standalone apko.yaml
+  dockerfile    a Dockerfile adding the script to the image built from it,
+                to be placed next to the script
+  devcontainer  a devcontainer.json using the built image, conventionally
+                written to .devcontainer/devcontainer.json
+
+Both the Dockerfile and the devcontainer refer to the image as --image,
+by default apko-shell-NAME:latest after the script's name. Accepts the same
+flags as a run; without a script, exports the environment of -p packages.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var scriptPath string
+			if len(args) > 0 {
+				scriptPath = args[0]
+			}
+
+			res, err := opts.resolve(cmd.Context(), scriptPath, layerFromFlags(config.SourceFlags, cmd.Flags(), opts))
+			if err != nil {
+				return err
+			}
+			ports, err := parsePorts(res.Ports)
+			if err != nil {
+				return err
+			}
+
+			env := export.Environment{
+				Name:        "apko-shell",
+				Image:       res.Image,
+				Interpreter: res.Interpreter,
+				Ports:       ports,
+			}
+			if scriptPath != "" {
+				env.Name = filepath.Base(scriptPath)
+				env.Script = filepath.Base(scriptPath)
+			}
+			env.ImageRef = imageRef
+			if env.ImageRef == "" {
+				env.ImageRef = export.ImageRef(env.Script)
+			}
+
+			data, err := export.Export(env, strings.ToLower(format))
+			if err != nil {
+				return err
+			}
+
+			if output == "" || output == "-" {
+				_, err := cmd.OutOrStdout().Write(data)
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(output), 0o755); err != nil {
+				return fmt.Errorf("creating output directory: %w", err)
+			}
+			if err := os.WriteFile(output, data, 0o644); err != nil {
+				return fmt.Errorf("writing %s: %w", output, err)
+			}
+			return nil
+		},
+	}
+
+	opts.addFlags(cmd.Flags())
+	cmd.Flags().StringVar(&format, "format", export.FormatApko, "Export format: "+strings.Join(export.Formats(), ", "))
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write to this file instead of stdout, creating its directory")
+	cmd.Flags().StringVar(&imageRef, "image", "", "Reference of the built image (default apko-shell-NAME:latest)")
+
+	return cmd
+}
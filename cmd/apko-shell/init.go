@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/scaffold"
+	"github.com/spf13/cobra"
+)
+
+func newInitCmd() *cobra.Command {
+	var (
+		python  bool
+		bash    bool
+		project bool
+		force   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "init [PATH]",
+		Short: "Create a new script or project configuration",
+		Long: `Create a new executable script that runs under apko-shell, with a
+#!apko-shell line and a commented apko block to fill in. The kind of
+script follows --python or --bash, or else the file extension: none,
+.sh or .bash for bash and .py for Python.
+
+With --project, create a project configuration (` + config.ProjectFile + `) in PATH, or
+in the current directory.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var (
+				path string
+				data []byte
+				mode fs.FileMode
+				err  error
+			)
+
+			if project {
+				path = config.ProjectFile
+				if len(args) > 0 {
+					path = args[0]
+					if info, err := os.Stat(path); err == nil && info.IsDir() {
+						path = filepath.Join(path, config.ProjectFile)
+					}
+				}
+				data, err = scaffold.Project()
+				mode = 0o644
+			} else {
+				if len(args) == 0 {
+					return fmt.Errorf("specify the path of the script to create")
+				}
+				path = args[0]
+
+				var kind string
+				switch {
+				case python:
+					kind = scaffold.Python
+				case bash:
+					kind = scaffold.Bash
+				default:
+					if kind, err = scaffold.KindOf(path); err != nil {
+						return fmt.Errorf("%w (use --bash or --python to choose)", err)
+					}
+				}
+				data, err = scaffold.Script(kind)
+				mode = 0o755
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := writeNew(path, data, mode, force); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Created %s\n", path)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&python, "python", false, "Create a Python script with PEP 723 metadata")
+	cmd.Flags().BoolVar(&bash, "bash", false, "Create a bash script")
+	cmd.Flags().BoolVar(&project, "project", false, "Create a project configuration file")
+	cmd.Flags().BoolVarP(&force, "force", "f", false, "Overwrite an existing file")
+	cmd.MarkFlagsMutuallyExclusive("python", "bash", "project")
+
+	return cmd
+}
+
+// writeNew writes a file that must not exist yet, unless force is set
+func writeNew(path string, data []byte, mode fs.FileMode, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(path, flags, mode)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+	}
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	// Keep an overwritten script executable
+	return os.Chmod(path, mode)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/joshrwolf/apko-shell/internal/builder"
+	"github.com/joshrwolf/apko-shell/internal/runtime"
+)
+
+const (
+	// controlMountPath is where the control directory is mounted in the container
+	controlMountPath = "/apko-shell/control"
+
+	// addHelperPath is where the apko-shell-add helper is mounted in the container
+	addHelperPath = "/usr/local/bin/apko-shell-add"
+
+	// Names of the helper and the command-not-found hook in the control directory
+	addHelperFile       = "apko-shell-add"
+	commandNotFoundFile = "command-not-found.sh"
+)
+
+// addHelper is the in-container apko-shell-add script. It records the
+// requested packages and the current directory in the control directory,
+// then hangs up the interactive shell so the host can rebuild and re-enter.
+// The shell is found through $APKO_SHELL_PID rather than $PPID, which is
+// another process when called from a subshell, a nested shell or a pipeline.
+const addHelper = `#!%s
+if [ $# -eq 0 ]; then
+	echo "usage: apko-shell-add PACKAGE..." >&2
+	exit 2
+fi
+if [ -z "$APKO_SHELL_PID" ]; then
+	echo "apko-shell-add: not in an apko-shell interactive shell" >&2
+	exit 1
+fi
+printf '%%s\n' "$@" >> %s/packages
+pwd > %s/cwd
+echo "apko-shell: adding $*, re-entering shell..." >&2
+kill -HUP "$APKO_SHELL_PID"
+`
+
+// shellPIDWrapper starts the image's command, an interactive shell, with
+// its own PID exported as APKO_SHELL_PID for apko-shell-add
+const shellPIDWrapper = `APKO_SHELL_PID=$$; export APKO_SHELL_PID; exec %s`
+
+// runInteractive runs an interactive shell whose package set can grow in
+// place: when apko-shell-add is used inside the container, the image is
+// rebuilt with the extra packages and a new shell is started in the same
+// working directory.
+func runInteractive(ctx context.Context, rt runtime.Runtime, b *builder.Builder, res *resolution, runOpts runtime.RunOptions) error {
+	log := clog.FromContext(ctx)
+	imageConfig := res.Image
+
+	controlDir, err := os.MkdirTemp("", "apko-shell-control-*")
+	if err != nil {
+		return fmt.Errorf("creating control dir: %w", err)
+	}
+	defer os.RemoveAll(controlDir)
+
+	helper := fmt.Sprintf(addHelper, res.Shell, controlMountPath, controlMountPath)
+	if err := os.WriteFile(filepath.Join(controlDir, addHelperFile), []byte(helper), 0o755); err != nil {
+		return fmt.Errorf("writing apko-shell-add helper: %w", err)
+	}
+
+	notFound := res.CommandNotFound
+	if notFound {
+		if err := writeCommandNotFoundHook(ctx, b, imageConfig, res.Shell, controlDir); err != nil {
+			log.Warn("not installing the command-not-found hook", "error", err)
+			notFound = false
+		}
+	}
+
+	runOpts = interactiveRunOptions(res, controlDir, notFound, runOpts)
+
+	for {
+		log.Info("running container", "interactive", runOpts.Interactive)
+		runErr := rt.Run(ctx, runOpts)
+
+		added, cwd, err := readAddRequest(controlDir)
+		if err != nil {
+			return err
+		}
+		if len(added) == 0 {
+			return runErr
+		}
+
+		packages := appendPackages(slices.Clone(imageConfig.Contents.Packages), added...)
+		log.Info("adding packages", "packages", added)
+
+		next := *imageConfig
+		next.Contents.Packages = packages
+		tarPath, err := b.Build(ctx, &next, "apko-shell:latest")
+		if err != nil {
+			// Keep the user in a working shell rather than dropping them out
+			log.Error("failed to add packages", "packages", added, "error", err)
+		} else {
+			imageConfig.Contents.Packages = packages
+			runOpts.ImagePath = tarPath
+		}
+
+		runOpts.ContainerWorkDir = cwd
+	}
+}
+
+// interactiveRunOptions returns runOpts set up for an interactive shell
+// using the files runInteractive writes to controlDir: an init process, the
+// control directory, the apko-shell-add helper, the command-not-found hook
+// when notFound is set, and a command exporting the shell's PID. It writes
+// nothing itself, so dry runs describe interactive runs with it too.
+func interactiveRunOptions(res *resolution, controlDir string, notFound bool, runOpts runtime.RunOptions) runtime.RunOptions {
+	// The shell must not be PID 1, otherwise it ignores the helper's SIGHUP
+	runOpts.Init = true
+	runOpts.Command = []string{res.Shell, "-c", fmt.Sprintf(shellPIDWrapper, res.Image.Cmd)}
+	runOpts.Mounts = append(slices.Clone(runOpts.Mounts),
+		runtime.Mount{Source: controlDir, Target: controlMountPath},
+		runtime.Mount{Source: filepath.Join(controlDir, addHelperFile), Target: addHelperPath, ReadOnly: true},
+	)
+
+	if notFound {
+		// bash and zsh read their rc files, POSIX shells $ENV
+		hookPath := filepath.Join(controlDir, commandNotFoundFile)
+		home := builder.HostUser().Home
+		runOpts.Mounts = append(runOpts.Mounts,
+			runtime.Mount{Source: hookPath, Target: path.Join(home, ".bashrc"), ReadOnly: true},
+			runtime.Mount{Source: hookPath, Target: path.Join(home, ".zshrc"), ReadOnly: true},
+		)
+		runOpts.Env = maps.Clone(runOpts.Env)
+		if runOpts.Env == nil {
+			runOpts.Env = map[string]string{}
+		}
+		runOpts.Env["ENV"] = path.Join(controlMountPath, commandNotFoundFile)
+	}
+
+	return runOpts
+}
+
+// readAddRequest reads and clears the packages requested by apko-shell-add,
+// along with the directory the request was made from
+func readAddRequest(controlDir string) ([]string, string, error) {
+	packagesPath := filepath.Join(controlDir, "packages")
+	data, err := os.ReadFile(packagesPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("reading package request: %w", err)
+	}
+	if err := os.Remove(packagesPath); err != nil {
+		return nil, "", fmt.Errorf("clearing package request: %w", err)
+	}
+
+	var cwd string
+	if data, err := os.ReadFile(filepath.Join(controlDir, "cwd")); err == nil {
+		cwd = strings.TrimSpace(string(data))
+	}
+
+	return strings.Fields(string(data)), cwd, nil
+}
+
+// appendPackages appends packages that aren't already present
+func appendPackages(packages []string, add ...string) []string {
+	for _, pkg := range add {
+		if !slices.Contains(packages, pkg) {
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
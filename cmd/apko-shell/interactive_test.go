@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/runtime"
+	"github.com/joshrwolf/apko-shell/internal/runtime/docker"
+)
+
+func TestInteractiveRunOptions(t *testing.T) {
+	res := &resolution{Resolved: &config.Resolved{
+		Shell: "/bin/bash",
+		Image: &types.ImageConfiguration{Cmd: "/bin/bash"},
+	}}
+	runOpts := runtime.RunOptions{
+		Interactive: true,
+		Mounts:      []runtime.Mount{{Source: "/cache/go", Target: "/root/go"}},
+		Env:         map[string]string{"A": "1"},
+	}
+
+	got := interactiveRunOptions(res, "/tmp/ctl", true, runOpts)
+
+	if !got.Init {
+		t.Error("interactive runs must use an init process")
+	}
+	if want := "/bin/bash -c APKO_SHELL_PID=$$; export APKO_SHELL_PID; exec /bin/bash"; strings.Join(got.Command, " ") != want {
+		t.Errorf("Command = %q, want %q", got.Command, want)
+	}
+	if got.Env["ENV"] != "/apko-shell/control/command-not-found.sh" || got.Env["A"] != "1" {
+		t.Errorf("Env = %v", got.Env)
+	}
+
+	// The caller's options are left alone
+	if len(runOpts.Mounts) != 1 || len(runOpts.Env) != 1 || runOpts.Init {
+		t.Errorf("interactiveRunOptions() modified its argument: %+v", runOpts)
+	}
+
+	invocation := strings.Join(docker.New().Describe(got, "IMAGE"), " ")
+	for _, want := range []string{
+		"--init",
+		"source=/tmp/ctl,target=/apko-shell/control",
+		"source=/tmp/ctl/apko-shell-add,target=/usr/local/bin/apko-shell-add,readonly",
+		"source=/tmp/ctl/command-not-found.sh,target=",
+		"IMAGE /bin/bash -c APKO_SHELL_PID=$$; export APKO_SHELL_PID; exec /bin/bash",
+	} {
+		if !strings.Contains(invocation, want) {
+			t.Errorf("Describe() = %q, missing %q", invocation, want)
+		}
+	}
+
+	// Without the hook, nothing refers to it
+	got = interactiveRunOptions(res, "/tmp/ctl", false, runtime.RunOptions{})
+	if _, ok := got.Env["ENV"]; ok || len(got.Mounts) != 2 {
+		t.Errorf("interactiveRunOptions() without the hook = %+v", got)
+	}
+}
+
+func TestReadAddRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    []string
+		wantCwd string
+		nothing bool
+	}{
+		{
+			name:    "no request",
+			nothing: true,
+		},
+		{
+			name:    "packages and directory",
+			files:   map[string]string{"packages": "jq\ncurl\n", "cwd": "/workspace/sub\n"},
+			want:    []string{"jq", "curl"},
+			wantCwd: "/workspace/sub",
+		},
+		{
+			name:  "requests appended by several calls",
+			files: map[string]string{"packages": "jq\nyq\njq\n"},
+			want:  []string{"jq", "yq", "jq"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, cwd, err := readAddRequest(dir)
+			if err != nil {
+				t.Fatalf("readAddRequest() error = %v", err)
+			}
+			if tt.nothing {
+				if got != nil || cwd != "" {
+					t.Errorf("readAddRequest() = %v, %q, want nothing", got, cwd)
+				}
+				return
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") || cwd != tt.wantCwd {
+				t.Errorf("readAddRequest() = %v, %q, want %v, %q", got, cwd, tt.want, tt.wantCwd)
+			}
+
+			// The request is consumed
+			if got, _, _ := readAddRequest(dir); got != nil {
+				t.Errorf("second readAddRequest() = %v, want nothing", got)
+			}
+		})
+	}
+}
+
+func TestAppendPackages(t *testing.T) {
+	tests := []struct {
+		packages []string
+		add      []string
+		want     []string
+	}{
+		{nil, []string{"jq"}, []string{"jq"}},
+		{[]string{"busybox", "jq"}, []string{"jq", "curl"}, []string{"busybox", "jq", "curl"}},
+		{[]string{"busybox"}, []string{"curl", "curl"}, []string{"busybox", "curl"}},
+		{[]string{"busybox"}, nil, []string{"busybox"}},
+	}
+
+	for _, tt := range tests {
+		if got := appendPackages(tt.packages, tt.add...); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("appendPackages(%v, %v) = %v, want %v", tt.packages, tt.add, got, tt.want)
+		}
+	}
+}
+
+func TestAddHelper(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+
+	controlDir := t.TempDir()
+	helper := filepath.Join(t.TempDir(), "apko-shell-add")
+	if err := os.WriteFile(helper, []byte(fmt.Sprintf(addHelper, sh, controlDir, controlDir)), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stands in for the interactive shell
+	shell := exec.Command("sleep", "30")
+	if err := shell.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer shell.Process.Kill()
+
+	workDir := t.TempDir()
+	cmd := exec.Command(helper, "jq", "curl")
+	cmd.Dir = workDir
+	cmd.Env = append(os.Environ(), "APKO_SHELL_PID="+strconv.Itoa(shell.Process.Pid))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("apko-shell-add error = %v, output %s", err, out)
+	}
+
+	// The shell was hung up
+	err = shell.Wait()
+	if status, ok := shell.ProcessState.Sys().(syscall.WaitStatus); !ok || !status.Signaled() || status.Signal() != syscall.SIGHUP {
+		t.Errorf("shell exited with %v, want SIGHUP", err)
+	}
+
+	got, cwd, err := readAddRequest(controlDir)
+	if err != nil || strings.Join(got, " ") != "jq curl" || cwd != workDir {
+		t.Errorf("readAddRequest() = %v, %q, %v; want [jq curl], %q", got, cwd, err, workDir)
+	}
+
+	// Outside an apko-shell shell, nothing is requested
+	cmd = exec.Command(helper, "jq")
+	cmd.Env = append(os.Environ(), "APKO_SHELL_PID=")
+	if err := cmd.Run(); err == nil {
+		t.Error("apko-shell-add without APKO_SHELL_PID succeeded, want error")
+	}
+	if got, _, _ := readAddRequest(controlDir); got != nil {
+		t.Errorf("apko-shell-add without APKO_SHELL_PID requested %v", got)
+	}
+
+	// Without packages, it prints its usage
+	cmd = exec.Command(helper)
+	if err := cmd.Run(); err == nil {
+		t.Error("apko-shell-add without packages succeeded, want error")
+	}
+}
+
+func TestShellPIDWrapper(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh")
+	}
+
+	// The wrapped command replaces the wrapper, so it runs with the PID
+	// the wrapper exported
+	out, err := exec.Command(sh, "-c", fmt.Sprintf(shellPIDWrapper, `sh -c 'echo "$APKO_SHELL_PID $$"'`)).Output()
+	if err != nil {
+		t.Fatalf("wrapper error = %v", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 || fields[0] != fields[1] || fields[0] == "" {
+		t.Errorf("wrapper output = %q, want APKO_SHELL_PID equal to the shell's PID", out)
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,18 +8,20 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
 
-	"chainguard.dev/apko/pkg/build/types"
 	"github.com/chainguard-dev/clog"
 	"github.com/chainguard-dev/clog/slag"
 	charmlog "github.com/charmbracelet/log"
 	"github.com/joshrwolf/apko-shell/internal/builder"
+	"github.com/joshrwolf/apko-shell/internal/config"
 	"github.com/joshrwolf/apko-shell/internal/runtime"
 	"github.com/joshrwolf/apko-shell/internal/runtime/docker"
-	"github.com/joshrwolf/apko-shell/internal/script"
+	"github.com/joshrwolf/apko-shell/internal/workspace"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 type options struct {
@@ -28,9 +29,54 @@ type options struct {
 
 	packages    []string
 	interactive bool
+	notFound    bool
 	buildOnly   bool
 	shell       string
 	command     string
+	publish     []string
+	secrets     []string
+	ssh         bool
+	gitConfig   bool
+	caches      []string
+	outputDir   string
+	noWorkDir   bool
+	sandbox     bool
+	overlay     bool
+	workDir     string
+	mountRepo   bool
+	interpreter string
+	auto        bool
+	dryRun      bool
+
+	// Output options of a dry run
+	json    bool
+	offline bool
+}
+
+// addFlags defines the flags of a run on fs
+func (o *options) addFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVarP(&o.packages, "packages", "p", nil, "APK packages to install")
+	fs.BoolVar(&o.auto, "auto", false, "Install the packages providing the commands a shell script runs, see 'apko-shell suggest'")
+	fs.BoolVarP(&o.interactive, "interactive", "i", false, "Start interactive shell")
+	fs.BoolVar(&o.notFound, "command-not-found", false, "In an interactive bash or zsh shell, suggest packages providing missing commands")
+	fs.BoolVar(&o.buildOnly, "build-only", false, "Build image only")
+	fs.StringVar(&o.shell, "shell", "/bin/sh", "Shell to use")
+	fs.StringVarP(&o.command, "command", "c", "", "Command to run (instead of script file)")
+	fs.StringVar(&o.interpreter, "interpreter", "", "Interpreter for the script, e.g. python3 or node (default: detected from the script, or --shell)")
+	fs.StringSliceVarP(&o.publish, "publish", "P", nil, "Publish container ports to the host (host:container)")
+	fs.StringArrayVar(&o.secrets, "secret", nil, "Expose a secret under /run/secrets (id=NAME,src=PATH or id=NAME,env=VAR)")
+	fs.BoolVar(&o.ssh, "ssh", false, "Forward the host SSH agent (SSH_AUTH_SOCK)")
+	fs.BoolVar(&o.gitConfig, "git-config", false, "Forward ~/.gitconfig and ~/.ssh/known_hosts read-only")
+	fs.StringSliceVar(&o.caches, "cache-mount", nil, "Mount a persistent cache (NAME:PATH or a preset such as go, pip, uv, npm, cargo)")
+	fs.StringVar(&o.outputDir, "output-dir", "", "Copy files written to /apko-shell/out into this directory after the run")
+	fs.BoolVar(&o.noWorkDir, "no-workdir", false, "Don't mount the working directory into the container")
+	fs.StringVar(&o.workDir, "workdir", "", "Working directory: a path, or \"script\" for the script's directory (default: the current directory)")
+	fs.BoolVar(&o.mountRepo, "mount-repo", true, "Mount the enclosing git repository root at /workspace")
+	fs.BoolVar(&o.sandbox, "sandbox", false, "Harden the container: read-only workspace and root filesystem, no capabilities, no network")
+	fs.BoolVar(&o.overlay, "sandbox-overlay", false, "Like --sandbox, but mount a writable throwaway copy of the workspace")
+	fs.BoolVar(&o.dryRun, "dry-run", false, "Show what would run, like 'apko-shell explain', without building or running anything")
+	fs.BoolVar(&o.json, "json", false, "Print output as JSON")
+	fs.BoolVar(&o.offline, "offline", false, "With --dry-run, don't resolve package versions against the repository indexes")
 }
 
 // setupLogging configures logging for the command
@@ -59,47 +105,68 @@ func run(ctx context.Context) error {
 	rootCmd := &cobra.Command{
 		Use:   "apko-shell [script]",
 		Short: "On-demand development environments using APK packages",
+		Args:  cobra.ArbitraryArgs,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Flags and arguments are valid by now, so errors from here on
+			// aren't usage errors
+			cmd.SilenceUsage = true
+
 			ctx = opts.setupLogging(ctx)
 			cmd.SetContext(ctx)
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return opts.run(cmd.Context(), args)
+			return opts.run(cmd.Context(), layerFromFlags(config.SourceFlags, cmd.Flags(), opts), args)
 		},
 	}
 
 	// Define flags
 	rootCmd.PersistentFlags().Var(&opts.logLevel, "log-level", "log level (debug, info, warn, error)")
-	rootCmd.Flags().StringSliceVarP(&opts.packages, "packages", "p", nil, "APK packages to install")
-	rootCmd.Flags().BoolVarP(&opts.interactive, "interactive", "i", false, "Start interactive shell")
-	rootCmd.Flags().BoolVar(&opts.buildOnly, "build-only", false, "Build image only")
-	rootCmd.Flags().StringVar(&opts.shell, "shell", "/bin/sh", "Shell to use")
-	rootCmd.Flags().StringVarP(&opts.command, "command", "c", "", "Command to run (instead of script file)")
-
-	// Merge shebang args if we're executing a script
-	if err := mergeShebangArgs(rootCmd); err != nil {
-		return fmt.Errorf("failed to parse shebang args: %w", err)
-	}
+	opts.addFlags(rootCmd.Flags())
+
+	rootCmd.AddCommand(
+		newSessionCmd(),
+		newCacheCmd(),
+		newConfigCmd(),
+		newExplainCmd(),
+		newSearchCmd(),
+		newWhichCmd(),
+		newSuggestCmd(),
+		newInitCmd(),
+		newAddCmd(),
+		newRemoveCmd(),
+		newExportCmd(),
+	)
 
 	return rootCmd.ExecuteContext(ctx)
 }
 
-func (o *options) run(ctx context.Context, args []string) error {
+func (o *options) run(ctx context.Context, flags config.Layer, args []string) error {
+	p, err := o.plan(ctx, flags, args)
+	if err != nil {
+		return err
+	}
+	defer p.cleanup()
+
+	// The script's header may ask for more logging than the command line
+	if p.LogLevel != "" && p.LogLevel != o.logLevel.String() {
+		if err := o.logLevel.Set(p.LogLevel); err != nil {
+			return fmt.Errorf("invalid log level: %w", err)
+		}
+		ctx = o.setupLogging(ctx)
+	}
 	log := clog.FromContext(ctx)
 
-	log.Debug("starting apko-shell", "args", args, "packages", o.packages)
+	if p.DryRun {
+		return p.explain(ctx)
+	}
+
+	log.Debug("starting apko-shell", "args", args, "packages", p.Image.Contents.Packages)
 
 	// Get cache directories
-	cacheDir, err := os.UserCacheDir()
+	cacheDir, tmpDir, err := workDirs()
 	if err != nil {
-		return fmt.Errorf("getting cache dir: %w", err)
-	}
-	cacheDir = filepath.Join(cacheDir, "apko-shell")
-
-	tmpDir := filepath.Join(os.TempDir(), "apko-shell")
-	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
-		return fmt.Errorf("creating temp dir: %w", err)
+		return err
 	}
 
 	// Detect runtime
@@ -111,318 +178,320 @@ func (o *options) run(ctx context.Context, args []string) error {
 
 	// Create builder
 	b := builder.New(cacheDir, tmpDir)
+	imageConfig := p.Image
 
-	// Build the appropriate image configuration
-	var imageConfig *types.ImageConfiguration
-	var scriptPath string
-	var scriptArgs []string
-	workDir := "."
+	// Log the final merged configuration for debugging
+	if configJSON, err := json.MarshalIndent(imageConfig, "", "  "); err == nil {
+		log.Debug("final image configuration", "config", string(configJSON))
+	}
 
-	// Handle inline command mode
-	if o.command != "" {
-		log.Debug("running inline command", "command", o.command)
+	// Build the image
+	log.Info("building image", "packages", imageConfig.Contents.Packages)
+	tarPath, err := b.Build(ctx, imageConfig, "apko-shell:latest")
+	if err != nil {
+		return fmt.Errorf("building image: %w", err)
+	}
 
-		// Write command to a temporary script file
-		tmpFile, err := os.CreateTemp("", "apko-shell-inline-*.sh")
-		if err != nil {
-			return fmt.Errorf("creating temp script: %w", err)
-		}
-		scriptPath = tmpFile.Name()
-		defer os.Remove(scriptPath)
+	// If build-only, we're done
+	if p.BuildOnly {
+		fmt.Println(tarPath)
+		return nil
+	}
 
-		// Write shebang and command
-		if _, err := fmt.Fprintf(tmpFile, "#!%s\n%s\n", o.shell, o.command); err != nil {
-			tmpFile.Close()
-			return fmt.Errorf("writing inline script: %w", err)
-		}
-		if err := tmpFile.Close(); err != nil {
-			return fmt.Errorf("closing temp script: %w", err)
-		}
+	// Run the container
+	runOpts := p.runOpts
+	runOpts.ImagePath = tarPath
 
-		// Make it executable
-		if err := os.Chmod(scriptPath, 0o755); err != nil {
-			return fmt.Errorf("chmod temp script: %w", err)
-		}
+	if p.Interactive {
+		return runInteractive(ctx, rt, b, p.resolution, runOpts)
+	}
 
-		imageConfig = &types.ImageConfiguration{
-			Contents: types.ImageContents{
-				Packages: o.packages,
-			},
-			Cmd: o.shell,
-		}
+	log.Info("running container", "interactive", runOpts.Interactive)
+	return rt.Run(ctx, runOpts)
+}
 
-		// Use current directory as working directory
-		workDir, err = os.Getwd()
-		if err != nil {
-			return fmt.Errorf("getting working directory: %w", err)
-		}
-	} else if len(args) > 0 {
-		// When invoked as shebang interpreter: #!/usr/bin/env apko-shell
-		// args[0] will be the script path, remaining args are script arguments
-		scriptPath = args[0]
-		scriptArgs = args[1:]
+// plan is everything a run needs except the image itself
+type plan struct {
+	*resolution
 
-		log.Debug("running script", "path", scriptPath, "args", scriptArgs)
+	// Script given on the command line, if any
+	scriptPath string
 
-		// Parse the script to get config
-		f, err := os.Open(scriptPath)
-		if err != nil {
-			return fmt.Errorf("opening script: %w", err)
-		}
-		defer f.Close()
+	// Options for the runtime, without the image
+	runOpts runtime.RunOptions
 
-		cfg, err := script.Parse(f)
+	// Removes temporary files created for the run
+	cleanup func()
+}
+
+// plan resolves the image configuration and runtime options of a run.
+// For a dry run it has no side effects: inline commands are not written
+// out, and neither cache directories nor a workspace overlay are created.
+func (o *options) plan(ctx context.Context, flags config.Layer, args []string) (_ *plan, err error) {
+	log := clog.FromContext(ctx)
+
+	var cleanups []func()
+	cleanup := func() {
+		for _, f := range slices.Backward(cleanups) {
+			f()
+		}
+	}
+	defer func() {
 		if err != nil {
-			return fmt.Errorf("parsing script: %w", err)
+			cleanup()
 		}
+	}()
 
-		// Build image configuration from script
-		if cfg.ImageConfig != nil {
-			// Use PEP 723 config as base
-			imageConfig = cfg.ImageConfig
-			// Merge in CLI packages if any
-			if len(o.packages) > 0 {
-				imageConfig.Contents.Packages = append(imageConfig.Contents.Packages, o.packages...)
-			}
-		} else {
-			// No PEP 723, build from CLI flags
-			imageConfig = &types.ImageConfiguration{
-				Contents: types.ImageContents{
-					Packages: o.packages,
-				},
-				Cmd: o.shell,
-			}
+	var scriptPath string
+	var scriptArgs []string
+	var scriptDir string
+	if flags.Command == "" {
+		if len(args) == 0 && len(flags.Packages) == 0 {
+			return nil, fmt.Errorf("either provide a script or use -p to specify packages")
 		}
-
-		// Set working directory to script's directory
-		workDir = filepath.Dir(scriptPath)
-	} else if len(o.packages) > 0 {
-		// Direct invocation: apko-shell -p curl,jq
-		log.Debug("direct package invocation", "packages", o.packages)
-
-		imageConfig = &types.ImageConfiguration{
-			Contents: types.ImageContents{
-				Packages: o.packages,
-			},
-			Cmd: o.shell,
+		if len(args) > 0 {
+			// When invoked as shebang interpreter: #!/usr/bin/env apko-shell
+			// args[0] will be the script path, remaining args are script arguments
+			scriptPath = args[0]
+			scriptArgs = args[1:]
+			scriptDir = filepath.Dir(scriptPath)
+			log.Debug("running script", "path", scriptPath, "args", scriptArgs)
 		}
+	}
 
-		// Use current directory as working directory
-		workDir, err = os.Getwd()
-		if err != nil {
-			return fmt.Errorf("getting working directory: %w", err)
-		}
+	// Merge defaults, config files, the script and flags
+	res, err := o.resolve(ctx, scriptPath, flags)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.CheckSandbox(); err != nil {
+		return nil, err
+	}
+	addHostUser(res.Resolved)
+	imageConfig := res.Image
+	dryRun := res.DryRun
 
-	} else {
-		return fmt.Errorf("either provide a script or use -p to specify packages")
+	// The script's header may run a command instead of the script
+	command := res.Command
+	if command != "" {
+		scriptArgs = nil
 	}
+	givenScript := scriptPath
 
-	// Add default repositories if none specified
-	if len(imageConfig.Contents.RuntimeRepositories) == 0 {
-		imageConfig.Contents.RuntimeRepositories = []string{
-			"https://packages.wolfi.dev/os",
+	if res.Auto && (command != "" || scriptPath != "") {
+		src := command
+		if src == "" {
+			data, err := os.ReadFile(scriptPath)
+			if err != nil {
+				return nil, fmt.Errorf("reading script: %w", err)
+			}
+			src = string(data)
 		}
-		imageConfig.Contents.Keyring = []string{
-			"https://packages.wolfi.dev/os/wolfi-signing.rsa.pub",
+		if err := addDetectedPackages(ctx, res, src); err != nil {
+			return nil, err
 		}
 	}
 
-	// Add busybox if no packages specified
-	if len(imageConfig.Contents.Packages) == 0 {
-		imageConfig.Contents.Packages = []string{
-			"busybox",
+	// Handle inline command mode
+	if command != "" && dryRun {
+		scriptPath = filepath.Join(os.TempDir(), "apko-shell-inline-XXXX.sh")
+	} else if command != "" {
+		log.Debug("running inline command", "command", command)
+
+		// Write command to a temporary script file
+		tmpFile, err := os.CreateTemp("", "apko-shell-inline-*.sh")
+		if err != nil {
+			return nil, fmt.Errorf("creating temp script: %w", err)
 		}
-	}
+		scriptPath = tmpFile.Name()
+		cleanups = append(cleanups, func() { os.Remove(tmpFile.Name()) })
 
-	// Ensure the shell package is installed
-	shellPackages := map[string]string{
-		"/bin/sh":   "busybox",
-		"/bin/bash": "bash",
-	}
-	if shellPkg, ok := shellPackages[o.shell]; ok {
-		// Check if shell package is already in the list
-		found := false
-		for _, pkg := range imageConfig.Contents.Packages {
-			if pkg == shellPkg {
-				found = true
-				break
-			}
+		// Write shebang and command
+		if _, err := fmt.Fprintf(tmpFile, "#!%s\n%s\n", res.Shell, command); err != nil {
+			tmpFile.Close()
+			return nil, fmt.Errorf("writing inline script: %w", err)
 		}
-		if !found {
-			imageConfig.Contents.Packages = append(imageConfig.Contents.Packages, shellPkg)
+		if err := tmpFile.Close(); err != nil {
+			return nil, fmt.Errorf("closing temp script: %w", err)
+		}
+
+		// Make it executable
+		if err := os.Chmod(scriptPath, 0o755); err != nil {
+			return nil, fmt.Errorf("chmod temp script: %w", err)
 		}
+	} else if scriptPath == "" {
+		// Direct invocation: apko-shell -p curl,jq
+		log.Debug("direct package invocation", "packages", imageConfig.Contents.Packages)
 	}
 
-	// Log the final merged configuration for debugging
-	if configJSON, err := json.MarshalIndent(imageConfig, "", "  "); err == nil {
-		log.Debug("final image configuration", "config", string(configJSON))
+	// Scripts run from the invoking directory, like under any other
+	// interpreter; --workdir=script runs them from their own directory
+	workDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("getting working directory: %w", err)
 	}
+	outputDir := res.OutputDir
 
-	// Build the image
-	log.Info("building image", "packages", imageConfig.Contents.Packages)
-	tarPath, err := b.Build(ctx, imageConfig, "apko-shell:latest")
+	cacheMounts, err := resolveCacheMounts(imageConfig, res.Caches, !dryRun)
 	if err != nil {
-		return fmt.Errorf("building image: %w", err)
+		return nil, err
 	}
 
-	// If build-only, we're done
-	if o.buildOnly {
-		fmt.Println(tarPath)
-		return nil
+	// Outputs are written by the host user
+	if outputDir != "" {
+		builder.AddDirectory(imageConfig, runtime.OutputPath, builder.HostUser())
 	}
 
-	// If we have a script, create a rendered version with the correct shebang
-	var renderedScriptPath string
-	if scriptPath != "" {
-		renderedScriptPath, err = o.renderScript(ctx, scriptPath, o.shell)
-		if err != nil {
-			return fmt.Errorf("rendering script: %w", err)
+	switch res.WorkDir {
+	case "":
+	case "script":
+		if scriptDir == "" {
+			return nil, fmt.Errorf("--workdir=script requires a script")
 		}
-		log.Debug("rendered script", "original", scriptPath, "rendered", renderedScriptPath)
-		defer os.Remove(renderedScriptPath) // Clean up temp script
+		workDir = scriptDir
+	default:
+		workDir = res.WorkDir
 	}
 
-	// Run the container
-	runOpts := runtime.RunOptions{
-		ImagePath:   tarPath,
-		ScriptPath:  renderedScriptPath,
-		ScriptArgs:  scriptArgs,
-		WorkDir:     workDir,
-		Interactive: o.interactive,
+	// Mount the repository root (or the working directory itself) and
+	// start in the working directory's location within it
+	var layout workspace.Layout
+	if !res.NoWorkDir {
+		layout, err = workspace.Resolve(workDir, res.MountRepo)
+		if err != nil {
+			return nil, err
+		}
+		log.Debug("resolved workspace", "root", layout.Root, "workdir", layout.WorkDir)
 	}
 
-	log.Info("running container", "interactive", runOpts.Interactive)
-	return rt.Run(ctx, runOpts)
-}
+	// Invoke the unmodified script by the path it was given when it is
+	// reachable through the workspace, so $0 and BASH_SOURCE match the host
+	var scriptName string
+	if command == "" && scriptDir != "" && layout.Root != "" {
+		if p, ok := layout.ContainerPath(scriptPath); ok {
+			scriptName = p
 
-// mergeShebangArgs checks if we're executing a script and merges its shebang args
-func mergeShebangArgs(cmd *cobra.Command) error {
-	// Check if first arg looks like a script path
-	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
-		return nil // Not a script invocation
+			// Relative paths stay relative when we start where the caller did
+			cwd, cwdErr := os.Getwd()
+			absWorkDir, absErr := filepath.Abs(workDir)
+			if !filepath.IsAbs(scriptPath) && cwdErr == nil && absErr == nil && cwd == absWorkDir {
+				scriptName = filepath.ToSlash(scriptPath)
+			}
+		}
+		log.Debug("resolved script name", "path", scriptPath, "name", scriptName)
 	}
 
-	scriptPath := os.Args[1]
-	info, err := os.Stat(scriptPath)
-	if err != nil || info.IsDir() {
-		return nil // Not a file
+	var sandbox runtime.Sandbox
+	if res.Sandbox || res.SandboxOverlay {
+		sandbox = sandboxProfile
+
+		// Keep the home directory usable over the read-only root
+		sandbox.TmpfsDirs = []string{builder.HostUser().Home}
 	}
+	if res.SandboxOverlay && layout.Root != "" && !dryRun {
+		overlay, removeOverlay, err := overlayWorkDir(layout.Root)
+		if err != nil {
+			return nil, err
+		}
+		cleanups = append(cleanups, removeOverlay)
 
-	// Parse script for shebang args
-	f, err := os.Open(scriptPath)
-	if err != nil {
-		return fmt.Errorf("opening script: %w", err)
+		log.Debug("using workspace overlay", "workdir", layout.Root, "overlay", overlay)
+		layout.Root = overlay
+		sandbox.ReadOnlyWorkDir = false
 	}
-	defer f.Close()
 
-	cfg, err := script.Parse(f)
+	portMappings, err := parsePorts(res.Ports)
 	if err != nil {
-		return fmt.Errorf("parsing script: %w", err)
+		return nil, err
 	}
-
-	if len(cfg.ShebangArgs) == 0 {
-		return nil // No shebang args to merge
+	if sandbox.DisableNetwork && len(portMappings) > 0 {
+		return nil, fmt.Errorf("can't publish ports %s: --sandbox disables networking", strings.Join(res.Ports, ", "))
 	}
 
-	// Build merged args: shebang flags + original args
-	var mergedArgs []string
-
-	// Expand shebang args (each may contain multiple flags)
-	for _, arg := range cfg.ShebangArgs {
-		mergedArgs = append(mergedArgs, strings.Fields(arg)...)
+	secrets, err := parseSecrets(res.Secrets)
+	if err != nil {
+		return nil, err
 	}
 
-	// Append original args (script path + any script arguments)
-	mergedArgs = append(mergedArgs, os.Args[1:]...)
-
-	// Tell Cobra to use the merged args
-	cmd.SetArgs(mergedArgs)
-
-	return nil
+	mounts, err := credentialMounts(ctx, res.SSH, res.GitConfig)
+	if err != nil {
+		return nil, err
+	}
+	mounts = append(mounts, cacheMounts...)
+
+	return &plan{
+		resolution: res,
+		scriptPath: givenScript,
+		runOpts: runtime.RunOptions{
+			ScriptPath:       scriptPath,
+			ScriptName:       scriptName,
+			Interpreter:      res.Interpreter,
+			ScriptArgs:       scriptArgs,
+			WorkDir:          layout.Root,
+			ContainerWorkDir: layout.WorkDir,
+			Mounts:           mounts,
+			Ports:            portMappings,
+			Secrets:          secrets,
+			OutputDir:        outputDir,
+			Sandbox:          sandbox,
+			Interactive:      res.Interactive,
+		},
+		cleanup: cleanup,
+	}, nil
 }
 
-// renderScript creates a temporary script with the correct shebang
-func (o *options) renderScript(ctx context.Context, scriptPath, shell string) (string, error) {
-	log := clog.FromContext(ctx)
-	// Open the original script
-	input, err := os.Open(scriptPath)
+// userCacheDir returns the cache directory of apko-shell
+func userCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
 	if err != nil {
-		return "", fmt.Errorf("opening script: %w", err)
+		return "", fmt.Errorf("getting cache dir: %w", err)
 	}
-	defer input.Close()
+	return filepath.Join(cacheDir, "apko-shell"), nil
+}
 
-	// Create a temporary file for the rendered script
-	tmpFile, err := os.CreateTemp("", "apko-shell-script-*.sh")
+// workDirs returns the cache and temp directories used by apko-shell,
+// creating the temp directory if needed
+func workDirs() (string, string, error) {
+	cacheDir, err := userCacheDir()
 	if err != nil {
-		return "", fmt.Errorf("creating temp file: %w", err)
+		return "", "", err
 	}
-	tmpPath := tmpFile.Name()
-	log.Debug("created temp script file", "path", tmpPath)
 
-	// Write the correct shebang
-	log.Debug("writing shebang", "shell", shell)
-	if _, err := fmt.Fprintf(tmpFile, "#!%s\n", shell); err != nil {
-		tmpFile.Close()
-		os.Remove(tmpPath)
-		return "", fmt.Errorf("writing shebang: %w", err)
+	tmpDir := filepath.Join(os.TempDir(), "apko-shell")
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return "", "", fmt.Errorf("creating temp dir: %w", err)
 	}
 
-	// Copy the rest of the script, skipping apko-shell shebang lines
-	scanner := bufio.NewScanner(input)
-	lineNum := 0
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
-
-		// Skip apko-shell shebang lines
-		if lineNum == 1 && strings.HasPrefix(line, "#!") && strings.Contains(line, "apko-shell") {
-			continue
-		}
-		if strings.HasPrefix(line, "#!apko-shell") {
-			continue
-		}
+	return cacheDir, tmpDir, nil
+}
 
-		// Write all other lines
-		if _, err := fmt.Fprintln(tmpFile, line); err != nil {
-			tmpFile.Close()
-			os.Remove(tmpPath)
-			return "", fmt.Errorf("writing line: %w", err)
+// parsePorts parses port mappings from flags and script blocks
+func parsePorts(specs []string) ([]runtime.PortMapping, error) {
+	var ports []runtime.PortMapping
+	for _, spec := range specs {
+		pm, err := runtime.ParsePortMapping(spec)
+		if err != nil {
+			return nil, err
 		}
+		ports = append(ports, pm)
 	}
-
-	if err := scanner.Err(); err != nil {
-		tmpFile.Close()
-		os.Remove(tmpPath)
-		return "", fmt.Errorf("reading script: %w", err)
-	}
-
-	// Make the script executable
-	if err := tmpFile.Chmod(0o755); err != nil {
-		tmpFile.Close()
-		os.Remove(tmpPath)
-		return "", fmt.Errorf("chmod: %w", err)
-	}
-
-	if err := tmpFile.Close(); err != nil {
-		os.Remove(tmpPath)
-		return "", fmt.Errorf("closing temp file: %w", err)
-	}
-
-	// Debug: log the first few lines of the rendered script
-	if content, err := os.ReadFile(tmpPath); err == nil {
-		lines := strings.Split(string(content), "\n")
-		preview := strings.Join(lines[:min(5, len(lines))], "\n")
-		log.Debug("rendered script preview", "content", preview)
-	}
-
-	return tmpPath, nil
+	return ports, nil
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// parseSecrets parses secret specs from flags
+func parseSecrets(specs []string) ([]runtime.Secret, error) {
+	var secrets []runtime.Secret
+	for _, spec := range specs {
+		secret, err := runtime.ParseSecret(spec)
+		if err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(secrets, func(s runtime.Secret) bool { return s.ID == secret.ID }) {
+			return nil, fmt.Errorf("invalid secret %q: id %s is already used", spec, secret.ID)
+		}
+		secrets = append(secrets, secret)
 	}
-	return b
+	return secrets, nil
 }
 
 // detectRuntime returns an available container runtime
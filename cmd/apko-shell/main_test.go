@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshrwolf/apko-shell/internal/config"
+)
+
+func TestPlanSandbox(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "/tmp/agent.sock")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "evil.sh")
+	header := "#!apko-shell --ssh --git-config --workdir / --output-dir /tmp/rv/pwn --secret id=k,src=/etc/hostname\necho hi\n"
+	if err := os.WriteFile(path, []byte(header), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	yes := true
+	dryRun := config.Layer{Source: config.SourceFlags, DryRun: &yes, Offline: &yes}
+	sandboxed := dryRun
+	sandboxed.Sandbox = &yes
+
+	// The script can't reach past a sandbox the user asked for
+	o := &options{}
+	if _, err := o.plan(context.Background(), sandboxed, []string{path}); err == nil || !strings.Contains(err.Error(), "shebang sets") {
+		t.Errorf("plan() with --sandbox error = %v, want the shebang's settings rejected", err)
+	}
+
+	userConfig := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "apko-shell", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(userConfig), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(userConfig, []byte("sandbox: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.plan(context.Background(), dryRun, []string{path}); err == nil || !strings.Contains(err.Error(), "shebang sets") {
+		t.Errorf("plan() with sandbox in the user config error = %v, want the shebang's settings rejected", err)
+	}
+
+	// Without a sandbox the script's settings apply
+	if err := os.Remove(userConfig); err != nil {
+		t.Fatal(err)
+	}
+	p, err := o.plan(context.Background(), dryRun, []string{path})
+	if err != nil {
+		t.Fatalf("plan() error = %v", err)
+	}
+	if p.runOpts.OutputDir != "/tmp/rv/pwn" || len(p.runOpts.Secrets) != 1 {
+		t.Errorf("plan() run options = %+v", p.runOpts)
+	}
+}
+
+func TestParseSecrets(t *testing.T) {
+	secrets, err := parseSecrets([]string{"id=a,src=x", "id=b,env=B"})
+	if err != nil || len(secrets) != 2 {
+		t.Fatalf("parseSecrets() = %v, %v", secrets, err)
+	}
+
+	// Both would be staged as the same file
+	if _, err := parseSecrets([]string{"id=a,src=x", "id=a,env=Y"}); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Errorf("parseSecrets() with a duplicate id error = %v, want already used", err)
+	}
+}
+
+func TestPlanKeepsUserSandbox(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	writeFile(t, filepath.Join(configHome, "apko-shell", "config.yaml"), "sandbox: true\n")
+
+	path := filepath.Join(t.TempDir(), "serve.sh")
+	writeFile(t, path, "#!/usr/bin/env apko-shell\n#!apko-shell --sandbox=false\necho hi\n")
+
+	yes := true
+	flags := config.Layer{Source: config.SourceFlags, DryRun: &yes, Offline: &yes}
+	p, err := (&options{}).plan(context.Background(), flags, []string{path})
+	if err != nil {
+		t.Fatalf("plan() error = %v", err)
+	}
+	if !p.runOpts.Sandbox.ReadOnlyRootFS || !p.runOpts.Sandbox.DisableNetwork {
+		t.Errorf("plan() sandbox = %+v, want the user's sandbox", p.runOpts.Sandbox)
+	}
+
+	// So the script can't publish ports either
+	writeFile(t, path, "#!/usr/bin/env apko-shell\n#!apko-shell --sandbox=false -P 4444\necho hi\n")
+	if _, err := (&options{}).plan(context.Background(), flags, []string{path}); err == nil || !strings.Contains(err.Error(), "can't publish ports") {
+		t.Errorf("plan() error = %v, want ports rejected", err)
+	}
+
+	// The user can still turn it off
+	no := false
+	flags.Sandbox = &no
+	p, err = (&options{}).plan(context.Background(), flags, []string{path})
+	if err != nil {
+		t.Fatalf("plan() with --sandbox=false error = %v", err)
+	}
+	if p.runOpts.Sandbox.DisableNetwork || len(p.runOpts.Ports) != 1 {
+		t.Errorf("plan() with --sandbox=false = %+v", p.runOpts)
+	}
+}
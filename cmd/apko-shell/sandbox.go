@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/joshrwolf/apko-shell/internal/runtime"
+)
+
+// sandboxProfile is the hardened profile applied by --sandbox
+var sandboxProfile = runtime.Sandbox{
+	ReadOnlyWorkDir:  true,
+	ReadOnlyRootFS:   true,
+	DropCapabilities: true,
+	NoNewPrivileges:  true,
+	DisableNetwork:   true,
+}
+
+// overlayWorkDir copies workDir into a temporary directory so a sandboxed
+// run can modify its workspace without touching the original. Git
+// metadata is left out, being large and of no use without a network. The
+// returned cleanup function removes the copy.
+func overlayWorkDir(workDir string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "apko-shell-overlay-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("creating overlay dir: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	if err := copyTree(workDir, dir); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("copying workspace: %w", err)
+	}
+
+	return dir, cleanup, nil
+}
+
+// copyTree copies the directory tree at src into dst, preserving modes and
+// symlinks, except for .git directories and files
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Name() == ".git" && path != src {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			// Skip sockets, devices and other special files
+			return nil
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	// The mode given to OpenFile is subject to the umask
+	if err := out.Chmod(perm); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyTree(t *testing.T) {
+	src := t.TempDir()
+	for _, f := range []struct {
+		path string
+		mode fs.FileMode
+	}{
+		{"build.sh", 0o755},
+		{"secret.env", 0o600},
+		{"shared.txt", 0o664},
+		{"sub/main.go", 0o644},
+		{".git/config", 0o644},
+		{"sub/.git", 0o644},
+		{".gitignore", 0o644},
+	} {
+		path := filepath.Join(src, f.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(f.path), f.mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, f.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"run":          "build.sh",
+		"sub/dangling": "../missing",
+		"abs":          "/etc/hostname",
+	} {
+		if err := os.Symlink(target, filepath.Join(src, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "overlay")
+	if err := copyTree(src, dst); err != nil {
+		t.Fatalf("copyTree() error = %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		mode    fs.FileMode
+		link    string
+		missing bool
+	}{
+		{path: "build.sh", mode: 0o755},
+		{path: "secret.env", mode: 0o600},
+		{path: "shared.txt", mode: 0o664},
+		{path: "sub/main.go", mode: 0o644},
+		{path: ".gitignore", mode: 0o644},
+		{path: "run", link: "build.sh"},
+		{path: "sub/dangling", link: "../missing"},
+		{path: "abs", link: "/etc/hostname"},
+		{path: ".git", missing: true},
+		{path: "sub/.git", missing: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path := filepath.Join(dst, tt.path)
+			info, err := os.Lstat(path)
+			if tt.missing {
+				if err == nil {
+					t.Errorf("%s was copied", tt.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s wasn't copied: %v", tt.path, err)
+			}
+
+			if tt.link != "" {
+				if got, err := os.Readlink(path); err != nil || got != tt.link {
+					t.Errorf("%s links to %q, %v; want %q", tt.path, got, err, tt.link)
+				}
+				return
+			}
+
+			if info.Mode() != tt.mode {
+				t.Errorf("%s mode = %v, want %v", tt.path, info.Mode(), tt.mode)
+			}
+			if data, err := os.ReadFile(path); err != nil || string(data) != tt.path {
+				t.Errorf("%s = %q, %v; want %q", tt.path, data, err, tt.path)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/joshrwolf/apko-shell/internal/builder"
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/index"
+	"github.com/spf13/cobra"
+)
+
+// repoOptions selects the repositories to query, on top of the user and
+// project configuration
+type repoOptions struct {
+	repositories []string
+	keyring      []string
+}
+
+func (o *repoOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVarP(&o.repositories, "repository", "r", nil, "Additional APK repositories to query")
+	cmd.Flags().StringSliceVar(&o.keyring, "keyring", nil, "Additional keys to verify the repositories with")
+}
+
+// index returns the latest packages of the configured repositories
+func (o *repoOptions) index(ctx context.Context) ([]builder.Package, error) {
+	user, err := config.LoadUser()
+	if err != nil {
+		return nil, err
+	}
+	project, err := config.LoadProject(".")
+	if err != nil {
+		return nil, err
+	}
+	flags := config.Layer{Source: config.SourceFlags, Repositories: o.repositories, Keyring: o.keyring}
+
+	res := config.Resolve(nil, user, project, flags)
+
+	cacheDir, tmpDir, err := workDirs()
+	if err != nil {
+		return nil, err
+	}
+	return builder.New(cacheDir, tmpDir).Index(ctx, res.Image)
+}
+
+func newSearchCmd() *cobra.Command {
+	var (
+		repos  repoOptions
+		asJSON bool
+		limit  int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "search TERM",
+		Short: "Search the configured repositories for packages",
+		Long: `Search the configured repositories for packages whose name, provided
+commands or description contain TERM. Repositories come from the user and
+project configuration, defaulting to Wolfi; indexes are cached alongside
+downloaded packages.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgs, err := repos.index(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			results := index.Search(pkgs, args[0])
+			more := 0
+			if limit > 0 && len(results) > limit {
+				more = len(results) - limit
+				results = results[:limit]
+			}
+
+			if asJSON {
+				if results == nil {
+					results = []index.Result{}
+				}
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(results)
+			}
+
+			if len(results) == 0 {
+				return fmt.Errorf("no packages match %q", args[0])
+			}
+			if err := printPackages(cmd.OutOrStdout(), results); err != nil {
+				return err
+			}
+			if more > 0 {
+				fmt.Fprintf(cmd.ErrOrStderr(), "%d more matches, raise --limit to show them\n", more)
+			}
+			return nil
+		},
+	}
+
+	repos.addFlags(cmd)
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the matches as JSON")
+	cmd.Flags().IntVarP(&limit, "limit", "n", 50, "Show at most this many matches (0 for all)")
+
+	return cmd
+}
+
+// printPackages writes a table of search results
+func printPackages(out io.Writer, results []index.Result) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tVERSION\tSIZE\tORIGIN\tDESCRIPTION")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.Version, humanSize(int64(r.Size)), r.Origin, r.Description)
+	}
+	return w.Flush()
+}
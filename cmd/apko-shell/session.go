@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/joshrwolf/apko-shell/internal/builder"
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/runtime"
+	"github.com/joshrwolf/apko-shell/internal/session"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+type sessionOptions struct {
+	packages []string
+	shell    string
+	workDir  string
+	publish  []string
+}
+
+// newSessionCmd creates the session command and its subcommands
+func newSessionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "session",
+		Short: "Manage persistent named environments",
+	}
+
+	cmd.AddCommand(
+		newSessionStartCmd(),
+		newSessionAttachCmd(),
+		newSessionExecCmd(),
+		newSessionStopCmd(),
+		newSessionListCmd(),
+	)
+
+	return cmd
+}
+
+func newSessionStartCmd() *cobra.Command {
+	opts := &sessionOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "start NAME",
+		Short: "Start a session container that keeps running in the background",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return opts.start(cmd.Context(), args[0])
+		},
+	}
+
+	cmd.Flags().StringSliceVarP(&opts.packages, "packages", "p", nil, "APK packages to install")
+	cmd.Flags().StringVar(&opts.shell, "shell", "", "Shell to use (default /bin/sh)")
+	cmd.Flags().StringVar(&opts.workDir, "workdir", ".", "Directory to mount as the workspace")
+	cmd.Flags().StringSliceVarP(&opts.publish, "publish", "P", nil, "Publish container ports to the host (host:container)")
+
+	return cmd
+}
+
+func (o *sessionOptions) start(ctx context.Context, name string) error {
+	log := clog.FromContext(ctx)
+
+	if err := session.ValidateName(name); err != nil {
+		return err
+	}
+
+	store, sessions, err := openSessions(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Replace stale state, but never clobber a live session
+	if existing, err := store.Get(name); err == nil {
+		if sessions.Running(ctx, existing.ContainerID) {
+			return fmt.Errorf("session %q is already running", name)
+		}
+		log.Debug("removing stale session", "name", name, "container", existing.ContainerID)
+		if err := sessions.Stop(ctx, existing.ContainerID); err != nil {
+			log.Debug("failed to remove stale container", "error", err)
+		}
+	} else if !errors.Is(err, session.ErrNotFound) {
+		return err
+	}
+
+	ports, err := parsePorts(o.publish)
+	if err != nil {
+		return err
+	}
+
+	workDir, err := filepath.Abs(o.workDir)
+	if err != nil {
+		return fmt.Errorf("resolving workdir: %w", err)
+	}
+
+	cacheDir, tmpDir, err := workDirs()
+	if err != nil {
+		return err
+	}
+
+	user, err := config.LoadUser()
+	if err != nil {
+		return err
+	}
+	project, err := config.LoadProject(workDir)
+	if err != nil {
+		return err
+	}
+	res := config.Resolve(nil, user, project, config.Layer{
+		Source:   config.SourceFlags,
+		Packages: o.packages,
+		Shell:    o.shell,
+	})
+	addShellPackage(res)
+	addHostUser(res)
+	imageConfig := res.Image
+
+	log.Info("building image", "packages", imageConfig.Contents.Packages)
+	tarPath, err := builder.New(cacheDir, tmpDir).Build(ctx, imageConfig, "apko-shell:latest")
+	if err != nil {
+		return fmt.Errorf("building image: %w", err)
+	}
+
+	log.Info("starting session", "name", name)
+	id, err := sessions.Start(ctx, session.ContainerName(name), runtime.RunOptions{
+		ImagePath: tarPath,
+		WorkDir:   workDir,
+		Ports:     ports,
+	})
+	if err != nil {
+		return fmt.Errorf("starting session: %w", err)
+	}
+
+	return store.Save(&session.Session{
+		Name:        name,
+		ContainerID: id,
+		Runtime:     fmt.Sprint(sessions),
+		WorkDir:     workDir,
+		Shell:       res.Shell,
+		Packages:    imageConfig.Contents.Packages,
+		Created:     time.Now(),
+	})
+}
+
+func newSessionAttachCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "attach NAME",
+		Short: "Open an interactive shell in a running session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			sess, sessions, err := runningSession(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			return sessions.Exec(ctx, sess.ContainerID, runtime.ExecOptions{
+				Command:     []string{sess.Shell},
+				Interactive: true,
+			})
+		},
+	}
+}
+
+func newSessionExecCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exec NAME COMMAND [ARG...]",
+		Short: "Run a command in a running session",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			sess, sessions, err := runningSession(ctx, args[0])
+			if err != nil {
+				return err
+			}
+
+			// Only allocate a TTY when we're attached to one
+			tty := isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd())
+
+			return sessions.Exec(ctx, sess.ContainerID, runtime.ExecOptions{
+				Command:     args[1:],
+				Interactive: tty,
+			})
+		},
+	}
+
+	// Everything after NAME belongs to the command
+	cmd.Flags().SetInterspersed(false)
+
+	return cmd
+}
+
+func newSessionStopCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stop NAME",
+		Short: "Stop a session and remove its container",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			store, sessions, err := openSessions(ctx)
+			if err != nil {
+				return err
+			}
+
+			sess, err := store.Get(args[0])
+			if err != nil {
+				return err
+			}
+
+			if err := sessions.Stop(ctx, sess.ContainerID); err != nil {
+				return fmt.Errorf("stopping session: %w", err)
+			}
+
+			return store.Delete(sess.Name)
+		},
+	}
+}
+
+func newSessionListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List sessions",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			store, sessions, err := openSessions(ctx)
+			if err != nil {
+				return err
+			}
+
+			list, err := store.List()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tSTATUS\tWORKDIR\tPACKAGES\tCREATED")
+			for _, sess := range list {
+				status := "stopped"
+				if sessions.Running(ctx, sess.ContainerID) {
+					status = "running"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+					sess.Name,
+					status,
+					sess.WorkDir,
+					strings.Join(sess.Packages, ","),
+					sess.Created.Format(time.RFC3339),
+				)
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
+// openSessions returns the session store and a runtime capable of managing sessions
+func openSessions(ctx context.Context) (*session.Store, runtime.Sessions, error) {
+	cacheDir, _, err := workDirs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rt, err := detectRuntime(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sessions, ok := rt.(runtime.Sessions)
+	if !ok {
+		return nil, nil, fmt.Errorf("runtime %v does not support sessions", rt)
+	}
+
+	return session.NewStore(filepath.Join(cacheDir, "sessions")), sessions, nil
+}
+
+// runningSession loads a session and verifies its container is still running
+func runningSession(ctx context.Context, name string) (*session.Session, runtime.Sessions, error) {
+	store, sessions, err := openSessions(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sess, err := store.Get(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !sessions.Running(ctx, sess.ContainerID) {
+		return nil, nil, fmt.Errorf("session %q is not running (use 'apko-shell session stop %s' to clean up)", name, name)
+	}
+
+	return sess, sessions, nil
+}
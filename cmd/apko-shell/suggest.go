@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/joshrwolf/apko-shell/internal/builder"
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/index"
+	"github.com/joshrwolf/apko-shell/internal/script"
+	"github.com/spf13/cobra"
+)
+
+// sourceAuto is the origin of packages detected by --auto
+const sourceAuto = "auto"
+
+// suggestion is a command a script invokes and the package providing it
+type suggestion struct {
+	index.Resolution
+	Line int `json:"line"`
+}
+
+func newSuggestCmd() *cobra.Command {
+	opts := &options{}
+
+	cmd := &cobra.Command{
+		Use:   "suggest SCRIPT",
+		Short: "Suggest the packages a shell script needs",
+		Long: `Suggest the packages a shell script needs by scanning it for the commands
+it invokes and looking them up in the "cmd:" provides of the configured
+repositories. Commands provided by several packages, or by none, are
+reported rather than guessed.
+
+Run a script with --auto to install the suggested packages automatically.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := opts.resolve(cmd.Context(), args[0], layerFromFlags(config.SourceFlags, cmd.Flags(), opts))
+			if err != nil {
+				return err
+			}
+
+			src, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("reading script: %w", err)
+			}
+
+			suggestions, err := suggestPackages(cmd.Context(), res, string(src))
+			if err != nil {
+				return err
+			}
+
+			if res.JSON {
+				if suggestions == nil {
+					suggestions = []suggestion{}
+				}
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(suggestions)
+			}
+			return printSuggestions(cmd.OutOrStdout(), suggestions)
+		},
+	}
+
+	opts.addFlags(cmd.Flags())
+
+	return cmd
+}
+
+// suggestPackages resolves the commands a shell script invokes against the
+// repositories of res, taking the packages res already installs into
+// account
+func suggestPackages(ctx context.Context, res *resolution, src string) ([]suggestion, error) {
+	log := clog.FromContext(ctx)
+
+	cmds := script.Commands(src)
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+
+	cacheDir, tmpDir, err := workDirs()
+	if err != nil {
+		return nil, err
+	}
+	b := builder.New(cacheDir, tmpDir)
+
+	available, err := b.Index(ctx, res.Image)
+	if err != nil {
+		return nil, err
+	}
+	installed, err := b.Resolve(ctx, res.Image)
+	if err != nil {
+		log.Warn("could not resolve the installed packages", "error", err)
+	}
+
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name
+	}
+
+	suggestions := make([]suggestion, len(cmds))
+	for i, r := range index.ResolveCommands(available, installed, names) {
+		suggestions[i] = suggestion{Resolution: r, Line: cmds[i].Line}
+	}
+	return suggestions, nil
+}
+
+// addDetectedPackages adds the packages providing the commands of a shell
+// script to res, warning about commands it can't attribute to a package
+func addDetectedPackages(ctx context.Context, res *resolution, src string) error {
+	log := clog.FromContext(ctx)
+
+	if !script.IsShell(res.Interpreter[0]) {
+		log.Warn("--auto only detects the packages of shell scripts", "interpreter", res.Interpreter[0])
+		return nil
+	}
+
+	suggestions, err := suggestPackages(ctx, res, src)
+	if err != nil {
+		return fmt.Errorf("detecting packages: %w", err)
+	}
+
+	for _, s := range suggestions {
+		switch {
+		case s.Package != "":
+			res.AddPackages(sourceAuto, s.Package)
+		case s.Ambiguous():
+			log.Warn("command is provided by several packages, add one with -p", "command", s.Command, "line", s.Line, "packages", strings.Join(s.Providers, ","))
+		case s.Unresolved():
+			log.Warn("no package provides command", "command", s.Command, "line", s.Line)
+		}
+	}
+	return nil
+}
+
+// printSuggestions writes suggestions for humans, followed by the shebang
+// line declaring the packages to add
+func printSuggestions(out io.Writer, suggestions []suggestion) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMMAND\tLINE\tPACKAGE\tSTATUS")
+
+	var add []string
+	for _, s := range suggestions {
+		switch {
+		case s.Installed != "":
+			fmt.Fprintf(w, "%s\t%d\t%s\tinstalled\n", s.Command, s.Line, s.Installed)
+		case s.Package != "":
+			fmt.Fprintf(w, "%s\t%d\t%s\tadd\n", s.Command, s.Line, s.Package)
+			if !slices.Contains(add, s.Package) {
+				add = append(add, s.Package)
+			}
+		case s.Ambiguous():
+			fmt.Fprintf(w, "%s\t%d\t%s\tambiguous\n", s.Command, s.Line, strings.Join(s.Providers, ", "))
+		default:
+			fmt.Fprintf(w, "%s\t%d\t-\tnot found\n", s.Command, s.Line)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(add) > 0 {
+		fmt.Fprintf(out, "\nDeclare them with:\n  #!apko-shell -p %s\n", strings.Join(add, ","))
+	}
+	return nil
+}
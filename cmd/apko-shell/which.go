@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"github.com/chainguard-dev/clog"
+	"github.com/joshrwolf/apko-shell/internal/builder"
+	"github.com/joshrwolf/apko-shell/internal/index"
+	"github.com/spf13/cobra"
+)
+
+func newWhichCmd() *cobra.Command {
+	var (
+		repos  repoOptions
+		asJSON bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "which COMMAND",
+		Short: "Find the packages providing a command",
+		Long: `Find the packages providing a command, from the "cmd:" provides of the
+configured repositories' indexes.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pkgs, err := repos.index(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			providers := index.Providers(pkgs, args[0])
+			if asJSON {
+				if providers == nil {
+					providers = []builder.Package{}
+				}
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(providers)
+			}
+
+			if len(providers) == 0 {
+				return fmt.Errorf("no package provides %q", args[0])
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVERSION\tORIGIN\tREPOSITORY")
+			for _, p := range providers {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, p.Version, p.Origin, p.Repository)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "\nRun with: apko-shell -p %s\n", providers[0].Name)
+			return nil
+		},
+	}
+
+	repos.addFlags(cmd)
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the providers as JSON")
+
+	return cmd
+}
+
+// commandNotFoundHook is sourced by interactive shells to suggest packages
+// for missing commands. bash and zsh call the handler; other shells ignore
+// it.
+const commandNotFoundHook = `# apko-shell command-not-found hook
+command_not_found_handle() {
+	while read -r cmd pkgs; do
+		if [ "$cmd" = "$1" ]; then
+			echo "$1: command not found, provided by: $pkgs" >&2
+			echo "  add it to this shell:  apko-shell-add ${pkgs%%%% *}" >&2
+			echo "  or run with:           apko-shell -p ${pkgs%%%% *}" >&2
+			return 127
+		fi
+	done < %s
+	echo "$1: command not found" >&2
+	return 127
+}
+command_not_found_handler() {
+	command_not_found_handle "$@"
+}
+`
+
+// commandNotFoundShells are the shells calling the hook's handler
+var commandNotFoundShells = []string{"bash", "zsh"}
+
+// writeCommandNotFoundHook writes the command table of the image's
+// repositories and the hook reading it to controlDir, see
+// interactiveRunOptions for how shells source it
+func writeCommandNotFoundHook(ctx context.Context, b *builder.Builder, imageConfig *types.ImageConfiguration, shell, controlDir string) error {
+	log := clog.FromContext(ctx)
+
+	if !slices.Contains(commandNotFoundShells, path.Base(shell)) {
+		log.Warn("the command-not-found hook requires bash or zsh", "shell", shell)
+	}
+
+	pkgs, err := b.Index(ctx, imageConfig)
+	if err != nil {
+		return err
+	}
+
+	table := index.CommandTable(pkgs)
+	cmds := make([]string, 0, len(table))
+	for cmd := range table {
+		cmds = append(cmds, cmd)
+	}
+	sort.Strings(cmds)
+
+	var sb strings.Builder
+	for _, cmd := range cmds {
+		fmt.Fprintf(&sb, "%s %s\n", cmd, strings.Join(table[cmd], " "))
+	}
+	if err := os.WriteFile(filepath.Join(controlDir, "commands"), []byte(sb.String()), 0o644); err != nil {
+		return fmt.Errorf("writing command table: %w", err)
+	}
+
+	hook := fmt.Sprintf(commandNotFoundHook, path.Join(controlMountPath, "commands"))
+	if err := os.WriteFile(filepath.Join(controlDir, commandNotFoundFile), []byte(hook), 0o644); err != nil {
+		return fmt.Errorf("writing command-not-found hook: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build ignore
+
+//!apko-shell --workdir=script
+// /// apko
+// contents:
+//   packages:
+//     - go
+// ///
+
+// hello is a single-file Go program with its environment declared inline;
+// run it with: apko-shell hello.go
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func main() {
+	fmt.Printf("Hello from %s on %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,12 @@
+#!/usr/bin/env apko-shell
+#!apko-shell -p python3
+# /// apko
+# ports:
+#   - 8000:8000
+# ///
+
+echo "Serving this directory on http://localhost:8000"
+echo
+
+# Bind to all interfaces so the published port is reachable from the host
+python3 -m http.server 8000 --bind 0.0.0.0
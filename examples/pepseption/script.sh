@@ -1,13 +1,5 @@
 #!/usr/bin/env apko-shell
-#!apko-shell -p python3,uv
-# /// apko
-# paths:
-#   - path: /.cache
-#     type: directory
-#     uid: 65532
-#     gid: 65532
-#     permissions: 0o777
-# ///
+#!apko-shell -p python3,uv --cache-mount uv --workdir=script
 
 echo "Running Python script with PEP 723 dependencies"
 echo "=============================================="
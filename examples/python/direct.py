@@ -0,0 +1,8 @@
+#!/usr/bin/env apko-shell
+#!apko-shell -p python3
+import sys
+
+# apko-shell runs .py files under python3 directly, no wrapper script needed
+print("Hello from Python running directly in apko-shell!")
+print(f"Python version: {sys.version}")
+print(f"Arguments: {sys.argv[1:]}")
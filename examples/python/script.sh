@@ -1,10 +1,10 @@
 #!/usr/bin/env apko-shell
-#!apko-shell -p python3
+#!apko-shell -p python3 --workdir=script
 
 echo "Running Python script with apko-shell"
 echo "===================================="
 echo
 
 # The Python script is in the same directory as this script
-# Since workdir is set to the script's directory, we can use relative path
+# Since --workdir=script runs us from the script's directory, we can use a relative path
 python3 hello.py arg1 arg2 arg3
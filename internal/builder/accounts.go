@@ -0,0 +1,135 @@
+package builder
+
+import (
+	"os"
+	"os/user"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// validUserName matches portable passwd user and group names
+var validUserName = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+
+// reservedUserNames are accounts already provided by the base layout
+var reservedUserNames = []string{"root", "nobody"}
+
+// User is an account to create in the image
+type User struct {
+	Name      string
+	GroupName string
+	UID       uint32
+	GID       uint32
+	Home      string
+}
+
+// HostUser returns an account mirroring the user running apko-shell, so
+// that containers run with the host UID/GID have a passwd entry and a home
+// directory
+func HostUser() User {
+	u := User{
+		Name:      "user",
+		GroupName: "user",
+		UID:       uint32(os.Getuid()),
+		GID:       uint32(os.Getgid()),
+	}
+
+	if u.UID == 0 {
+		return User{Name: "root", GroupName: "root", Home: "/root"}
+	}
+
+	if current, err := user.Current(); err == nil && isUsableName(current.Username) {
+		u.Name = current.Username
+		u.GroupName = current.Username
+	}
+	if group, err := user.LookupGroupId(strconv.FormatUint(uint64(u.GID), 10)); err == nil && isUsableName(group.Name) {
+		u.GroupName = group.Name
+	}
+
+	u.Home = path.Join("/home", u.Name)
+	return u
+}
+
+// AddUser adds passwd and group entries for u to the configuration, along
+// with a home directory it owns. Root and accounts whose UID is already
+// configured are left untouched.
+func AddUser(config *types.ImageConfiguration, u User, shell string) {
+	if u.UID == 0 {
+		return
+	}
+
+	accounts := &config.Accounts
+	if slices.ContainsFunc(accounts.Users, func(existing types.User) bool { return existing.UID == u.UID }) {
+		return
+	}
+
+	gid := u.GID
+	accounts.Users = append(accounts.Users, types.User{
+		UserName: u.Name,
+		UID:      u.UID,
+		GID:      types.GID(&gid),
+		Shell:    shell,
+		HomeDir:  u.Home,
+	})
+
+	if !slices.ContainsFunc(accounts.Groups, func(existing types.Group) bool { return existing.GID == u.GID }) {
+		accounts.Groups = append(accounts.Groups, types.Group{
+			GroupName: u.GroupName,
+			GID:       u.GID,
+			Members:   []string{u.Name},
+		})
+	}
+
+	// apko only applies ownership to directories when mutating recursively
+	config.Paths = append(config.Paths, types.PathMutation{
+		Path:        u.Home,
+		Type:        "directory",
+		UID:         u.UID,
+		GID:         u.GID,
+		Permissions: 0o755,
+		Recursive:   true,
+	})
+
+	if _, ok := config.Environment["HOME"]; !ok {
+		if config.Environment == nil {
+			config.Environment = map[string]string{}
+		}
+		config.Environment["HOME"] = u.Home
+	}
+}
+
+func isUsableName(name string) bool {
+	return validUserName.MatchString(name) && !slices.Contains(reservedUserNames, name)
+}
+
+// AddDirectory adds a directory owned by u to the configuration. Missing
+// parents inside u's home directory are added too, so that mounting below
+// home doesn't leave root-owned directories in the way.
+func AddDirectory(config *types.ImageConfiguration, dir string, u User) {
+	dirs := []string{dir}
+	if rel, ok := strings.CutPrefix(dir, u.Home+"/"); ok {
+		dirs = nil
+		parts := strings.Split(rel, "/")
+		for i := range parts {
+			dirs = append(dirs, path.Join(u.Home, path.Join(parts[:i+1]...)))
+		}
+	}
+
+	for _, d := range dirs {
+		if slices.ContainsFunc(config.Paths, func(existing types.PathMutation) bool { return existing.Path == d }) {
+			continue
+		}
+		config.Paths = append(config.Paths, types.PathMutation{
+			Path:        d,
+			Type:        "directory",
+			UID:         u.UID,
+			GID:         u.GID,
+			Permissions: 0o755,
+			Recursive:   true,
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestAddUser(t *testing.T) {
+	u := User{Name: "dev", GroupName: "staff", UID: 1000, GID: 20, Home: "/home/dev"}
+
+	config := &types.ImageConfiguration{}
+	AddUser(config, u, "/bin/bash")
+
+	if len(config.Accounts.Users) != 1 {
+		t.Fatalf("AddUser() got %d users, want 1", len(config.Accounts.Users))
+	}
+	got := config.Accounts.Users[0]
+	if got.UserName != "dev" || got.UID != 1000 || got.GID == nil || *got.GID != 20 || got.HomeDir != "/home/dev" || got.Shell != "/bin/bash" {
+		t.Errorf("AddUser() user = %+v", got)
+	}
+
+	if len(config.Accounts.Groups) != 1 || config.Accounts.Groups[0].GroupName != "staff" || config.Accounts.Groups[0].GID != 20 {
+		t.Errorf("AddUser() groups = %+v", config.Accounts.Groups)
+	}
+
+	if len(config.Paths) != 1 || config.Paths[0].Path != "/home/dev" || config.Paths[0].Type != "directory" || config.Paths[0].UID != 1000 {
+		t.Errorf("AddUser() paths = %+v", config.Paths)
+	}
+
+	if config.Environment["HOME"] != "/home/dev" {
+		t.Errorf("AddUser() HOME = %q, want %q", config.Environment["HOME"], "/home/dev")
+	}
+
+	// Adding the same UID again is a no-op
+	AddUser(config, u, "/bin/bash")
+	if len(config.Accounts.Users) != 1 || len(config.Paths) != 1 {
+		t.Errorf("AddUser() twice duplicated entries: %+v", config.Accounts)
+	}
+}
+
+func TestAddUserRoot(t *testing.T) {
+	config := &types.ImageConfiguration{}
+	AddUser(config, User{Name: "root", UID: 0, GID: 0, Home: "/root"}, "/bin/sh")
+
+	if len(config.Accounts.Users) != 0 || len(config.Paths) != 0 || config.Environment != nil {
+		t.Errorf("AddUser() for root modified config: %+v", config)
+	}
+}
+
+func TestAddUserExistingGroup(t *testing.T) {
+	config := &types.ImageConfiguration{
+		Accounts: types.ImageAccounts{
+			Groups: []types.Group{{GroupName: "users", GID: 100}},
+		},
+		Environment: map[string]string{"HOME": "/custom"},
+	}
+	AddUser(config, User{Name: "dev", GroupName: "dev", UID: 1000, GID: 100, Home: "/home/dev"}, "/bin/sh")
+
+	if len(config.Accounts.Groups) != 1 {
+		t.Errorf("AddUser() duplicated existing group: %+v", config.Accounts.Groups)
+	}
+	if config.Environment["HOME"] != "/custom" {
+		t.Errorf("AddUser() overrode HOME: %q", config.Environment["HOME"])
+	}
+}
+
+func TestAddDirectory(t *testing.T) {
+	u := User{Name: "dev", UID: 1000, GID: 1000, Home: "/home/dev"}
+
+	config := &types.ImageConfiguration{}
+	AddDirectory(config, "/home/dev/.cache/go-build", u)
+	AddDirectory(config, "/home/dev/.cache/pip", u)
+	AddDirectory(config, "/var/cache/tool", u)
+
+	var got []string
+	for _, p := range config.Paths {
+		if p.UID != 1000 || p.GID != 1000 || p.Type != "directory" {
+			t.Errorf("AddDirectory() path = %+v", p)
+		}
+		got = append(got, p.Path)
+	}
+
+	want := []string{
+		"/home/dev/.cache",
+		"/home/dev/.cache/go-build",
+		"/home/dev/.cache/pip",
+		"/var/cache/tool",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("AddDirectory() paths = %v, want %v", got, want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"time"
 
 	"chainguard.dev/apko/pkg/apk/apk"
@@ -40,18 +41,9 @@ func (b *Builder) Build(ctx context.Context, config *types.ImageConfiguration, t
 	// Default to host architecture
 	arch := types.ParseArchitecture(runtime.GOARCH)
 
-	// Create build options
-	opts := []build.Option{
-		build.WithImageConfiguration(*config),
-		build.WithArch(arch),
-		build.WithCache(b.cacheDir, false, apk.NewCache(true)),
-		build.WithTempDir(b.tmpDir),
-	}
-
-	// Create build context
-	bc, err := build.New(ctx, tarfs.New(), opts...)
+	bc, err := b.buildContext(ctx, config, arch)
 	if err != nil {
-		return "", fmt.Errorf("creating build context: %w", err)
+		return "", err
 	}
 
 	// Build the image filesystem
@@ -93,6 +85,108 @@ func (b *Builder) Build(ctx context.Context, config *types.ImageConfiguration, t
 	return outputPath, nil
 }
 
+// Package is a package available in, or installed from, a repository
+type Package struct {
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Origin      string   `json:"origin,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Size        uint64   `json:"size"`
+	Provides    []string `json:"provides,omitempty"`
+	Repository  string   `json:"repository,omitempty"`
+}
+
+func newPackage(p *apk.RepositoryPackage) Package {
+	var repo string
+	if r := p.Repository(); r != nil {
+		repo = r.URI
+	}
+	return Package{
+		Name:        p.Name,
+		Version:     p.Version,
+		Origin:      p.Origin,
+		Description: p.Description,
+		Size:        p.InstalledSize,
+		Provides:    p.Provides,
+		Repository:  repo,
+	}
+}
+
+// Resolve resolves the packages an image configuration installs, including
+// dependencies, against the repository indexes without building anything
+func (b *Builder) Resolve(ctx context.Context, config *types.ImageConfiguration) ([]Package, error) {
+	bc, err := b.buildContext(ctx, config, types.ParseArchitecture(runtime.GOARCH))
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, _, err := bc.BuildPackageList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgs := make([]Package, 0, len(resolved))
+	for _, p := range resolved {
+		pkgs = append(pkgs, newPackage(p))
+	}
+	return pkgs, nil
+}
+
+// Index returns the latest version of every package in the repositories
+// of an image configuration, for the host architecture. Indexes are
+// cached alongside downloaded packages.
+func (b *Builder) Index(ctx context.Context, config *types.ImageConfiguration) ([]Package, error) {
+	bc, err := b.buildContext(ctx, config, types.ParseArchitecture(runtime.GOARCH))
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := bc.APK().GetRepositoryIndexes(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("fetching repository indexes: %w", err)
+	}
+
+	latest := map[string]*apk.RepositoryPackage{}
+	versions := map[string]apk.Version{}
+	for _, index := range indexes {
+		for _, p := range index.Packages() {
+			v, err := apk.ParseVersion(p.Version)
+			if err != nil {
+				continue
+			}
+			if cur, ok := versions[p.Name]; ok && apk.CompareVersions(v, cur) <= 0 {
+				continue
+			}
+			latest[p.Name] = p
+			versions[p.Name] = v
+		}
+	}
+
+	pkgs := make([]Package, 0, len(latest))
+	for _, p := range latest {
+		pkgs = append(pkgs, newPackage(p))
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+	return pkgs, nil
+}
+
+// buildContext creates an apko build context for config, sharing the
+// package cache between builds
+func (b *Builder) buildContext(ctx context.Context, config *types.ImageConfiguration, arch types.Architecture) (*build.Context, error) {
+	opts := []build.Option{
+		build.WithImageConfiguration(*config),
+		build.WithArch(arch),
+		build.WithCache(b.cacheDir, false, apk.NewCache(true)),
+		build.WithTempDir(b.tmpDir),
+	}
+
+	bc, err := build.New(ctx, tarfs.New(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating build context: %w", err)
+	}
+	return bc, nil
+}
+
 // writeImageTarball writes an OCI image to a tarball file
 func (b *Builder) writeImageTarball(img v1.Image, tag, outputPath string) error {
 	// Parse the tag
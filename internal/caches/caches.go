@@ -0,0 +1,193 @@
+package caches
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// validName matches cache names, which double as directory names
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Mount is a named cache directory mounted into the container
+type Mount struct {
+	// Name of the cache, shared by every run that mounts it
+	Name string
+
+	// Path inside the container; a leading ~ refers to the home directory
+	Target string
+}
+
+// presets are the cache directories of common toolchains
+var presets = map[string][]Mount{
+	"go": {
+		{Name: "go-build", Target: "~/.cache/go-build"},
+		{Name: "go-mod", Target: "~/go/pkg/mod"},
+	},
+	"pip": {
+		{Name: "pip", Target: "~/.cache/pip"},
+	},
+	"uv": {
+		{Name: "uv", Target: "~/.cache/uv"},
+	},
+	"npm": {
+		{Name: "npm", Target: "~/.npm"},
+	},
+	"cargo": {
+		{Name: "cargo-registry", Target: "~/.cargo/registry"},
+		{Name: "cargo-git", Target: "~/.cargo/git"},
+	},
+}
+
+// Presets returns the names of the built-in presets
+func Presets() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Preset returns the mounts of a built-in preset
+func Preset(name string) ([]Mount, bool) {
+	mounts, ok := presets[name]
+	return mounts, ok
+}
+
+// Parse parses a cache mount of the form NAME:PATH, or the name of a
+// built-in preset
+func Parse(spec string) ([]Mount, error) {
+	name, target, ok := strings.Cut(spec, ":")
+	if !ok {
+		mounts, ok := presets[spec]
+		if !ok {
+			return nil, fmt.Errorf("invalid cache mount %q: expected NAME:PATH or one of %s", spec, strings.Join(Presets(), ", "))
+		}
+		return mounts, nil
+	}
+
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("invalid cache mount %q: name must match %s", spec, validName)
+	}
+	if !strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "~/") {
+		return nil, fmt.Errorf("invalid cache mount %q: path must be absolute or start with ~/", spec)
+	}
+
+	return []Mount{{Name: name, Target: target}}, nil
+}
+
+// Path returns the container path of the mount, resolving ~ against home
+func (m Mount) Path(home string) string {
+	if rest, ok := strings.CutPrefix(m.Target, "~/"); ok {
+		return path.Join(home, rest)
+	}
+	return path.Clean(m.Target)
+}
+
+// Entry describes a cache stored on the host
+type Entry struct {
+	Name string
+	Path string
+	Size int64
+}
+
+// Store manages cache directories on the host
+type Store struct {
+	dir string
+}
+
+// NewStore creates a Store rooted at dir
+func NewStore(dir string) *Store {
+	return &Store{
+		dir: dir,
+	}
+}
+
+// Path returns the host directory backing the named cache, which may not
+// exist yet
+func (s *Store) Path(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid cache name %q", name)
+	}
+	return filepath.Join(s.dir, name), nil
+}
+
+// Dir returns the host directory backing the named cache, creating it if needed
+func (s *Store) Dir(name string) (string, error) {
+	dir, err := s.Path(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating cache dir: %w", err)
+	}
+	return dir, nil
+}
+
+// List returns all caches sorted by name
+func (s *Store) List() ([]Entry, error) {
+	dirs, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading cache dir: %w", err)
+	}
+
+	var entries []Entry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(s.dir, d.Name())
+		size, err := dirSize(dir)
+		if err != nil {
+			return nil, fmt.Errorf("measuring cache %s: %w", d.Name(), err)
+		}
+		entries = append(entries, Entry{Name: d.Name(), Path: dir, Size: size})
+	}
+
+	return entries, nil
+}
+
+// Remove deletes the named cache
+func (s *Store) Remove(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid cache name %q", name)
+	}
+
+	dir := filepath.Join(s.dir, name)
+	if _, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("cache %s: %w", name, err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("removing cache %s: %w", name, err)
+	}
+	return nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
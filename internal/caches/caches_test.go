@@ -0,0 +1,117 @@
+package caches
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []Mount
+		wantErr bool
+	}{
+		{
+			name: "named mount",
+			spec: "go-build:/home/user/.cache/go-build",
+			want: []Mount{{Name: "go-build", Target: "/home/user/.cache/go-build"}},
+		},
+		{
+			name: "home relative",
+			spec: "pip:~/.cache/pip",
+			want: []Mount{{Name: "pip", Target: "~/.cache/pip"}},
+		},
+		{
+			name: "preset",
+			spec: "go",
+			want: []Mount{
+				{Name: "go-build", Target: "~/.cache/go-build"},
+				{Name: "go-mod", Target: "~/go/pkg/mod"},
+			},
+		},
+		{
+			name:    "unknown preset",
+			spec:    "maven",
+			wantErr: true,
+		},
+		{
+			name:    "relative path",
+			spec:    "x:cache",
+			wantErr: true,
+		},
+		{
+			name:    "invalid name",
+			spec:    "../x:/cache",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Parse(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Parse(%q)[%d] = %v, want %v", tt.spec, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMountPath(t *testing.T) {
+	if got := (Mount{Target: "~/.npm"}).Path("/home/dev"); got != "/home/dev/.npm" {
+		t.Errorf("Path() = %q, want %q", got, "/home/dev/.npm")
+	}
+	if got := (Mount{Target: "/var/cache/x/"}).Path("/home/dev"); got != "/var/cache/x" {
+		t.Errorf("Path() = %q, want %q", got, "/var/cache/x")
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := NewStore(t.TempDir())
+
+	path, err := s.Path("npm")
+	if err != nil {
+		t.Fatalf("Path() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Path() created %s", path)
+	}
+
+	dir, err := s.Dir("npm")
+	if err != nil {
+		t.Fatalf("Dir() error = %v", err)
+	}
+	if dir != path {
+		t.Errorf("Dir() = %s, want %s", dir, path)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "blob"), []byte("12345"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := s.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "npm" || entries[0].Size != 5 {
+		t.Errorf("List() = %+v, want npm of 5 bytes", entries)
+	}
+
+	if err := s.Remove("npm"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := s.Remove("npm"); err == nil {
+		t.Error("Remove() of missing cache succeeded, want error")
+	}
+	if _, err := s.Dir("../escape"); err == nil {
+		t.Error("Dir() with invalid name succeeded, want error")
+	}
+}
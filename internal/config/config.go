@@ -0,0 +1,406 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of configuration, lowest precedence first
+const (
+	SourceDefault = "default"
+	SourceUser    = "user config"
+	SourceProject = "project config"
+	SourceScript  = "script"
+	SourceShebang = "shebang"
+	SourceFlags   = "flags"
+)
+
+// Trusted reports whether a layer from source was set up by the user
+// running apko-shell, rather than found next to the script it runs
+func Trusted(source string) bool {
+	for _, prefix := range []string{SourceDefault, SourceUser, SourceFlags} {
+		if strings.HasPrefix(source, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectFile is the name of the project configuration file, looked up
+// from the script's directory towards the repository root
+const ProjectFile = "apko-shell.yaml"
+
+// Defaults used when no layer provides a value
+var (
+	DefaultShell        = "/bin/sh"
+	DefaultPackages     = []string{"busybox"}
+	DefaultRepositories = []string{"https://packages.wolfi.dev/os"}
+	DefaultKeyring      = []string{"https://packages.wolfi.dev/os/wolfi-signing.rsa.pub"}
+)
+
+// Layer is the configuration contributed by one source. Layers are merged
+// in precedence order: user config, project config, the script's blocks,
+// its shebang arguments, then command line flags. Lists accumulate without
+// duplicates, environment variables, scalars and switches are overridden by
+// later layers, except that only trusted layers can turn --sandbox off.
+type Layer struct {
+	// Source describes where the layer came from
+	Source string `yaml:"-"`
+
+	Packages     []string          `yaml:"packages,omitempty"`
+	Repositories []string          `yaml:"repositories,omitempty"`
+	Keyring      []string          `yaml:"keyring,omitempty"`
+	Shell        string            `yaml:"shell,omitempty"`
+	Environment  map[string]string `yaml:"environment,omitempty"`
+	Ports        []string          `yaml:"ports,omitempty"`
+	Caches       []string          `yaml:"caches,omitempty"`
+
+	// Host directory receiving the script's outputs, absolute or relative
+	// to the working directory of the caller
+	OutputDir string `yaml:"output-dir,omitempty"`
+
+	// Command running the script, such as "python3 -u"
+	Interpreter string `yaml:"interpreter,omitempty"`
+
+	// Secrets as id=NAME,src=PATH or id=NAME,env=VAR
+	Secrets []string `yaml:"secrets,omitempty"`
+
+	// Working directory: a path, or "script" for the script's directory
+	WorkDir string `yaml:"workdir,omitempty"`
+
+	// Switches left unset (nil) by the layer
+	SSH             *bool `yaml:"ssh,omitempty"`
+	GitConfig       *bool `yaml:"git-config,omitempty"`
+	NoWorkDir       *bool `yaml:"no-workdir,omitempty"`
+	MountRepo       *bool `yaml:"mount-repo,omitempty"`
+	Sandbox         *bool `yaml:"sandbox,omitempty"`
+	SandboxOverlay  *bool `yaml:"sandbox-overlay,omitempty"`
+	Auto            *bool `yaml:"auto,omitempty"`
+	CommandNotFound *bool `yaml:"command-not-found,omitempty"`
+
+	// What to do with the environment, set by shebang arguments and flags
+	// only
+	Command     string `yaml:"-"`
+	Interactive *bool  `yaml:"-"`
+	BuildOnly   *bool  `yaml:"-"`
+	DryRun      *bool  `yaml:"-"`
+	JSON        *bool  `yaml:"-"`
+	Offline     *bool  `yaml:"-"`
+	LogLevel    string `yaml:"-"`
+}
+
+// Origin records the source of one resolved value
+type Origin struct {
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Resolved is the outcome of merging configuration layers
+type Resolved struct {
+	Image     *types.ImageConfiguration
+	Shell     string
+	Ports     []string
+	Caches    []string
+	OutputDir string
+
+	// Interpreter set by a layer, split into words; empty to use the
+	// script's own
+	Interpreter []string
+
+	Secrets         []string
+	WorkDir         string
+	SSH             bool
+	GitConfig       bool
+	NoWorkDir       bool
+	MountRepo       bool
+	Sandbox         bool
+	SandboxOverlay  bool
+	Auto            bool
+	CommandNotFound bool
+
+	Command     string
+	Interactive bool
+	BuildOnly   bool
+	DryRun      bool
+	JSON        bool
+	Offline     bool
+	LogLevel    string
+
+	// Origins of every managed value, in resolution order
+	Origins []Origin
+}
+
+// Resolve merges layers, lowest precedence first, into base, the script's
+// image configuration, if any. Package, repository, keyring and
+// environment settings of base are replaced by the merged values; its
+// other fields are kept. Defaults fill in anything left unset.
+func Resolve(base *types.ImageConfiguration, layers ...Layer) *Resolved {
+	img := &types.ImageConfiguration{}
+	if base != nil {
+		*img = *base
+	}
+	img.Contents.Packages = nil
+	img.Contents.RuntimeRepositories = nil
+	img.Contents.Keyring = nil
+	img.Environment = nil
+
+	r := &Resolved{Image: img, MountRepo: true}
+	env := map[string]string{}
+	envSource := map[string]string{}
+	s := &settings{origins: map[string]Origin{}}
+
+	for _, l := range layers {
+		img.Contents.Packages = r.merge("contents.packages", l.Source, img.Contents.Packages, l.Packages)
+		img.Contents.RuntimeRepositories = r.merge("contents.repositories", l.Source, img.Contents.RuntimeRepositories, l.Repositories)
+		img.Contents.Keyring = r.merge("contents.keyring", l.Source, img.Contents.Keyring, l.Keyring)
+		r.Ports = r.merge("ports", l.Source, r.Ports, l.Ports)
+		r.Caches = r.merge("caches", l.Source, r.Caches, l.Caches)
+		r.Secrets = r.merge("secrets", l.Source, r.Secrets, l.Secrets)
+
+		for k, v := range l.Environment {
+			env[k] = v
+			envSource[k] = l.Source
+		}
+
+		s.str("shell", l.Source, &r.Shell, l.Shell)
+		s.str("output-dir", l.Source, &r.OutputDir, l.OutputDir)
+		s.str("workdir", l.Source, &r.WorkDir, l.WorkDir)
+		s.str("command", l.Source, &r.Command, l.Command)
+		if l.Interpreter != "" {
+			r.Interpreter = strings.Fields(l.Interpreter)
+			s.record("interpreter", l.Source, l.Interpreter)
+		}
+
+		s.flag("ssh", l.Source, &r.SSH, l.SSH)
+		s.flag("git-config", l.Source, &r.GitConfig, l.GitConfig)
+		s.flag("no-workdir", l.Source, &r.NoWorkDir, l.NoWorkDir)
+		s.flag("mount-repo", l.Source, &r.MountRepo, l.MountRepo)
+		// A script can't lift the sandbox the user asked for
+		if l.Sandbox == nil || *l.Sandbox || Trusted(l.Source) || !r.Sandbox {
+			s.flag("sandbox", l.Source, &r.Sandbox, l.Sandbox)
+		}
+		s.flag("sandbox-overlay", l.Source, &r.SandboxOverlay, l.SandboxOverlay)
+		s.flag("auto", l.Source, &r.Auto, l.Auto)
+		s.flag("command-not-found", l.Source, &r.CommandNotFound, l.CommandNotFound)
+		s.flag("interactive", l.Source, &r.Interactive, l.Interactive)
+		s.flag("build-only", l.Source, &r.BuildOnly, l.BuildOnly)
+		s.flag("dry-run", l.Source, &r.DryRun, l.DryRun)
+
+		// Output settings don't describe the environment, so have no origin
+		if l.JSON != nil {
+			r.JSON = *l.JSON
+		}
+		if l.Offline != nil {
+			r.Offline = *l.Offline
+		}
+		if l.LogLevel != "" {
+			r.LogLevel = l.LogLevel
+		}
+	}
+
+	if len(img.Contents.Packages) == 0 {
+		img.Contents.Packages = r.merge("contents.packages", SourceDefault, nil, DefaultPackages)
+	}
+	if len(img.Contents.RuntimeRepositories) == 0 {
+		img.Contents.RuntimeRepositories = r.merge("contents.repositories", SourceDefault, nil, DefaultRepositories)
+		if len(img.Contents.Keyring) == 0 {
+			img.Contents.Keyring = r.merge("contents.keyring", SourceDefault, nil, DefaultKeyring)
+		}
+	}
+	if r.Shell == "" {
+		s.str("shell", SourceDefault, &r.Shell, DefaultShell)
+	}
+	if img.Cmd == "" {
+		img.Cmd = r.Shell
+	}
+
+	for _, field := range s.order {
+		r.Origins = append(r.Origins, s.origins[field])
+	}
+
+	if len(env) > 0 {
+		img.Environment = env
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			r.Origins = append(r.Origins, Origin{Field: "environment", Value: k + "=" + env[k], Source: envSource[k]})
+		}
+	}
+
+	return r
+}
+
+// settings tracks the origin of the final value of each scalar setting
+type settings struct {
+	order   []string
+	origins map[string]Origin
+}
+
+// record notes that source set field to value
+func (s *settings) record(field, source, value string) {
+	if _, ok := s.origins[field]; !ok {
+		s.order = append(s.order, field)
+	}
+	s.origins[field] = Origin{Field: field, Value: value, Source: source}
+}
+
+// str sets *dst to v unless it is empty
+func (s *settings) str(field, source string, dst *string, v string) {
+	if v != "" {
+		*dst = v
+		s.record(field, source, v)
+	}
+}
+
+// flag sets *dst to *v unless it is nil
+func (s *settings) flag(field, source string, dst *bool, v *bool) {
+	if v != nil {
+		*dst = *v
+		s.record(field, source, strconv.FormatBool(*v))
+	}
+}
+
+// merge appends the values of add missing from list, recording their origin
+func (r *Resolved) merge(field, source string, list, add []string) []string {
+	for _, v := range add {
+		if slices.Contains(list, v) {
+			continue
+		}
+		list = append(list, v)
+		r.Origins = append(r.Origins, Origin{Field: field, Value: v, Source: source})
+	}
+	return list
+}
+
+// sandboxedFields are the settings that reach past the sandbox, to
+// credentials or host paths outside the workspace
+var sandboxedFields = []string{"ssh", "git-config", "secrets", "output-dir", "workdir", "mount-repo", "caches"}
+
+// CheckSandbox rejects settings that reach past the sandbox unless they
+// come from a trusted layer, so that a script can't take them for itself
+// under --sandbox
+func (r *Resolved) CheckSandbox() error {
+	if !r.Sandbox && !r.SandboxOverlay {
+		return nil
+	}
+	for _, o := range r.Origins {
+		if slices.Contains(sandboxedFields, o.Field) && o.Value != "false" && !Trusted(o.Source) {
+			return fmt.Errorf("%s sets %s, which --sandbox only accepts from flags or the user config", o.Source, o.Field)
+		}
+	}
+	return nil
+}
+
+// AddPackages adds packages required by derived settings, such as the
+// script's interpreter, recording source as their origin
+func (r *Resolved) AddPackages(source string, pkgs ...string) {
+	r.Image.Contents.Packages = r.merge("contents.packages", source, r.Image.Contents.Packages, pkgs)
+}
+
+// Load reads a configuration file. A missing file yields an empty layer.
+func Load(path, source string) (Layer, error) {
+	l := Layer{Source: source}
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return l, fmt.Errorf("opening config: %w", err)
+	}
+	defer f.Close()
+
+	l, err = Parse(f, source)
+	if err != nil {
+		return l, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	// Relative output and working directories are relative to the file
+	if l.OutputDir != "" && !filepath.IsAbs(l.OutputDir) {
+		l.OutputDir = filepath.Join(filepath.Dir(path), l.OutputDir)
+	}
+	if l.WorkDir != "" && l.WorkDir != "script" && !filepath.IsAbs(l.WorkDir) {
+		l.WorkDir = filepath.Join(filepath.Dir(path), l.WorkDir)
+	}
+	return l, nil
+}
+
+// Parse strictly decodes a configuration layer, rejecting unknown keys
+func Parse(r io.Reader, source string) (Layer, error) {
+	var l Layer
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&l); err != nil && !errors.Is(err, io.EOF) {
+		return Layer{Source: source}, err
+	}
+	l.Source = source
+	return l, nil
+}
+
+// UserPath returns the path of the user configuration file
+func UserPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("getting config dir: %w", err)
+	}
+	return filepath.Join(dir, "apko-shell", "config.yaml"), nil
+}
+
+// LoadUser reads the user configuration file, if any
+func LoadUser() (Layer, error) {
+	path, err := UserPath()
+	if err != nil {
+		// Without a config directory there is no user config to read
+		return Layer{Source: SourceUser}, nil
+	}
+	return Load(path, SourceUser+" "+path)
+}
+
+// FindProject returns the nearest ProjectFile in dir or its parents, not
+// looking past the root of the enclosing git repository
+func FindProject(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return "", false
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// LoadProject reads the project configuration nearest to dir, if any
+func LoadProject(dir string) (Layer, error) {
+	path, ok := FindProject(dir)
+	if !ok {
+		return Layer{Source: SourceProject}, nil
+	}
+	return Load(path, SourceProject+" "+path)
+}
@@ -0,0 +1,294 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestResolve(t *testing.T) {
+	base := &types.ImageConfiguration{
+		Contents: types.ImageContents{Packages: []string{"stale"}},
+		Cmd:      "/usr/bin/python3",
+		WorkDir:  "/src",
+	}
+
+	r := Resolve(base,
+		Layer{Source: SourceUser, Packages: []string{"git"}, Shell: "/bin/bash", Environment: map[string]string{"EDITOR": "vi", "LANG": "C"}},
+		Layer{Source: SourceProject, Packages: []string{"make", "git"}, Caches: []string{"go"}},
+		Layer{Source: SourceScript, Packages: []string{"python3"}, Environment: map[string]string{"LANG": "C.UTF-8"}, OutputDir: "/out/script"},
+		Layer{Source: SourceShebang, Packages: []string{"jq"}, Ports: []string{"8080"}},
+		Layer{Source: SourceFlags, Packages: []string{"python3", "curl"}, Shell: "/bin/zsh", OutputDir: "/out/flags"},
+	)
+
+	if got, want := strings.Join(r.Image.Contents.Packages, ","), "git,make,python3,jq,curl"; got != want {
+		t.Errorf("packages = %s, want %s", got, want)
+	}
+	if got, want := strings.Join(r.Image.Contents.RuntimeRepositories, ","), strings.Join(DefaultRepositories, ","); got != want {
+		t.Errorf("repositories = %s, want %s", got, want)
+	}
+	if r.Shell != "/bin/zsh" {
+		t.Errorf("shell = %s, want /bin/zsh", r.Shell)
+	}
+	if r.OutputDir != "/out/flags" {
+		t.Errorf("output dir = %s, want /out/flags", r.OutputDir)
+	}
+	if r.Image.Environment["LANG"] != "C.UTF-8" || r.Image.Environment["EDITOR"] != "vi" {
+		t.Errorf("environment = %v", r.Image.Environment)
+	}
+	if r.Image.Cmd != "/usr/bin/python3" || r.Image.WorkDir != "/src" {
+		t.Errorf("unmanaged fields not kept: cmd %q, workdir %q", r.Image.Cmd, r.Image.WorkDir)
+	}
+	if base.Contents.Packages[0] != "stale" {
+		t.Errorf("base was modified: %v", base.Contents.Packages)
+	}
+
+	origins := map[string]string{}
+	for _, o := range r.Origins {
+		origins[o.Field+" "+o.Value] = o.Source
+	}
+	for key, want := range map[string]string{
+		"contents.packages git":                           SourceUser,
+		"contents.packages python3":                       SourceScript,
+		"contents.packages curl":                          SourceFlags,
+		"contents.repositories " + DefaultRepositories[0]: SourceDefault,
+		"caches go":                SourceProject,
+		"ports 8080":               SourceShebang,
+		"shell /bin/zsh":           SourceFlags,
+		"environment LANG=C.UTF-8": SourceScript,
+		"environment EDITOR=vi":    SourceUser,
+	} {
+		if origins[key] != want {
+			t.Errorf("origin of %s = %q, want %q", key, origins[key], want)
+		}
+	}
+}
+
+func TestResolveSwitches(t *testing.T) {
+	yes, no := true, false
+
+	r := Resolve(nil,
+		Layer{Source: SourceProject, Sandbox: &yes, MountRepo: &no, WorkDir: "/repo/tools", Secrets: []string{"id=a,env=A"}},
+		Layer{Source: SourceShebang, Interpreter: "python3 -u", Sandbox: &no, SSH: &yes, Command: "echo hi", Secrets: []string{"id=b,env=B"}},
+		Layer{Source: SourceFlags, WorkDir: "script", DryRun: &yes, JSON: &yes},
+	)
+
+	if !r.Sandbox || !r.SSH || r.MountRepo || !r.DryRun || !r.JSON {
+		t.Errorf("switches = %+v", r)
+	}
+	if strings.Join(r.Interpreter, " ") != "python3 -u" || len(r.Interpreter) != 2 {
+		t.Errorf("interpreter = %q, want [python3 -u]", r.Interpreter)
+	}
+	if r.WorkDir != "script" || r.Command != "echo hi" {
+		t.Errorf("workdir = %q, command = %q", r.WorkDir, r.Command)
+	}
+	if strings.Join(r.Secrets, " ") != "id=a,env=A id=b,env=B" {
+		t.Errorf("secrets = %v", r.Secrets)
+	}
+
+	origins := map[string]string{}
+	for _, o := range r.Origins {
+		origins[o.Field+" "+o.Value] = o.Source
+	}
+	for key, want := range map[string]string{
+		"sandbox true":           SourceProject,
+		"mount-repo false":       SourceProject,
+		"workdir script":         SourceFlags,
+		"interpreter python3 -u": SourceShebang,
+		"secrets id=b,env=B":     SourceShebang,
+	} {
+		if origins[key] != want {
+			t.Errorf("origin of %s = %q, want %q", key, origins[key], want)
+		}
+	}
+	if _, ok := origins["sandbox false"]; ok {
+		t.Error("ignored value has an origin")
+	}
+
+	// Only the user can turn the sandbox off
+	userConfig := SourceUser + " /home/me/.config/apko-shell/config.yaml"
+	for _, tt := range []struct {
+		layers []Layer
+		want   bool
+		source string
+	}{
+		{[]Layer{{Source: userConfig, Sandbox: &yes}, {Source: SourceShebang, Sandbox: &no}}, true, userConfig},
+		{[]Layer{{Source: userConfig, Sandbox: &yes}, {Source: SourceProject + " /repo/apko-shell.yaml", Sandbox: &no}}, true, userConfig},
+		{[]Layer{{Source: SourceShebang, Sandbox: &yes}, {Source: SourceFlags, Sandbox: &no}}, false, SourceFlags},
+		{[]Layer{{Source: userConfig, Sandbox: &yes}, {Source: SourceShebang, Sandbox: &no}, {Source: SourceFlags, Sandbox: &no}}, false, SourceFlags},
+		{[]Layer{{Source: userConfig, Sandbox: &no}, {Source: SourceScript, Sandbox: &yes}}, true, SourceScript},
+	} {
+		r := Resolve(nil, tt.layers...)
+		if r.Sandbox != tt.want {
+			t.Errorf("Resolve(%+v) sandbox = %v, want %v", tt.layers, r.Sandbox, tt.want)
+		}
+		for _, o := range r.Origins {
+			if o.Field == "sandbox" && o.Source != tt.source {
+				t.Errorf("Resolve(%+v) sandbox origin = %q, want %q", tt.layers, o.Source, tt.source)
+			}
+		}
+	}
+
+	// Unset switches keep their defaults
+	r = Resolve(nil, Layer{Source: SourceFlags})
+	if !r.MountRepo || r.Sandbox || r.DryRun {
+		t.Errorf("defaults = %+v", r)
+	}
+}
+
+func TestCheckSandbox(t *testing.T) {
+	yes, no := true, false
+	userConfig := SourceUser + " /home/me/.config/apko-shell/config.yaml"
+	project := SourceProject + " /tmp/download/apko-shell.yaml"
+
+	tests := []struct {
+		name    string
+		layers  []Layer
+		wantErr string
+	}{
+		{
+			name:   "not sandboxed",
+			layers: []Layer{{Source: SourceShebang, SSH: &yes, WorkDir: "/", Secrets: []string{"id=k,src=/etc/hostname"}}},
+		},
+		{
+			name: "trusted layers",
+			layers: []Layer{
+				{Source: userConfig, Sandbox: &yes, GitConfig: &yes, Caches: []string{"go"}},
+				{Source: SourceFlags, SSH: &yes, WorkDir: "/src", OutputDir: "/out", Secrets: []string{"id=k,env=K"}},
+			},
+		},
+		{
+			name:   "switches turned off",
+			layers: []Layer{{Source: SourceFlags, Sandbox: &yes}, {Source: SourceShebang, SSH: &no, MountRepo: &no}},
+		},
+		{
+			name:    "shebang ssh",
+			layers:  []Layer{{Source: SourceShebang, SSH: &yes}, {Source: SourceFlags, Sandbox: &yes}},
+			wantErr: "shebang sets ssh",
+		},
+		{
+			name:    "shebang workdir",
+			layers:  []Layer{{Source: SourceFlags, Sandbox: &yes}, {Source: SourceShebang, WorkDir: "/"}},
+			wantErr: "shebang sets workdir",
+		},
+		{
+			name:    "script output dir",
+			layers:  []Layer{{Source: userConfig, Sandbox: &yes}, {Source: SourceScript, OutputDir: "/tmp/rv/pwn"}},
+			wantErr: "script sets output-dir",
+		},
+		{
+			name:    "project secrets",
+			layers:  []Layer{{Source: project, Secrets: []string{"id=k,src=/etc/hostname"}}, {Source: SourceFlags, SandboxOverlay: &yes}},
+			wantErr: project + " sets secrets",
+		},
+		{
+			name:    "project caches",
+			layers:  []Layer{{Source: project, Caches: []string{"go"}}, {Source: SourceFlags, Sandbox: &yes}},
+			wantErr: project + " sets caches",
+		},
+		{
+			name:    "shebang git config",
+			layers:  []Layer{{Source: SourceShebang, Sandbox: &yes, GitConfig: &yes}},
+			wantErr: "shebang sets git-config",
+		},
+		{
+			name:    "shebang mount repo",
+			layers:  []Layer{{Source: SourceFlags, Sandbox: &yes}, {Source: SourceShebang, MountRepo: &yes}},
+			wantErr: "shebang sets mount-repo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Resolve(nil, tt.layers...).CheckSandbox()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckSandbox() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckSandbox() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveDefaults(t *testing.T) {
+	r := Resolve(nil, Layer{Source: SourceFlags})
+
+	if got := strings.Join(r.Image.Contents.Packages, ","); got != "busybox" {
+		t.Errorf("packages = %s, want busybox", got)
+	}
+	if r.Shell != DefaultShell || r.Image.Cmd != DefaultShell {
+		t.Errorf("shell = %s, cmd = %s, want %s", r.Shell, r.Image.Cmd, DefaultShell)
+	}
+	if len(r.Image.Contents.Keyring) != 1 {
+		t.Errorf("keyring = %v, want the default", r.Image.Contents.Keyring)
+	}
+
+	// Custom repositories replace the defaults, keys included
+	r = Resolve(nil, Layer{Source: SourceProject, Repositories: []string{"https://example.com/os"}})
+	if got := strings.Join(r.Image.Contents.RuntimeRepositories, ","); got != "https://example.com/os" {
+		t.Errorf("repositories = %s", got)
+	}
+	if len(r.Image.Contents.Keyring) != 0 {
+		t.Errorf("keyring = %v, want none", r.Image.Contents.Keyring)
+	}
+}
+
+func TestLoadProject(t *testing.T) {
+	tmp := t.TempDir()
+	repo := filepath.Join(tmp, "repo")
+	sub := filepath.Join(repo, "scripts", "ci")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files outside the repository are not picked up
+	if err := os.WriteFile(filepath.Join(tmp, ProjectFile), []byte("packages: [outside]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := LoadProject(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Packages) != 0 {
+		t.Errorf("LoadProject() = %+v, want empty", l)
+	}
+
+	project := filepath.Join(repo, ProjectFile)
+	if err := os.WriteFile(project, []byte("packages: [go]\nshell: /bin/bash\noutput-dir: dist\nworkdir: tools\nsandbox: true\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err = LoadProject(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(l.Packages, ",") != "go" || l.Shell != "/bin/bash" {
+		t.Errorf("LoadProject() = %+v", l)
+	}
+	if l.OutputDir != filepath.Join(repo, "dist") || l.WorkDir != filepath.Join(repo, "tools") {
+		t.Errorf("output dir = %s, workdir = %s, want them relative to the file", l.OutputDir, l.WorkDir)
+	}
+	if l.Sandbox == nil || !*l.Sandbox {
+		t.Errorf("sandbox = %v, want true", l.Sandbox)
+	}
+	if !strings.Contains(l.Source, project) {
+		t.Errorf("source = %q, want it to name %s", l.Source, project)
+	}
+
+	// Unknown keys are rejected
+	if err := os.WriteFile(project, []byte("pakages: [go]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProject(sub); err == nil {
+		t.Error("LoadProject() with an unknown key succeeded")
+	}
+}
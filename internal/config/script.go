@@ -0,0 +1,52 @@
+package config
+
+import (
+	"path/filepath"
+
+	"github.com/joshrwolf/apko-shell/internal/script"
+)
+
+// ScriptLayer returns the layer contributed by a script's metadata blocks
+// along with its image configuration, the base for resolution
+func ScriptLayer(cfg *script.Config, scriptPath string) Layer {
+	l := Layer{
+		Source: SourceScript,
+		Ports:  cfg.Ports,
+		Caches: cfg.Caches,
+	}
+
+	if img := cfg.ImageConfig; img != nil {
+		l.Packages = img.Contents.Packages
+		l.Repositories = img.Contents.RuntimeRepositories
+		l.Keyring = img.Contents.Keyring
+		if len(img.Environment) > 0 {
+			l.Environment = map[string]string{}
+			for k, v := range img.Environment {
+				l.Environment[k] = v
+			}
+		}
+	}
+
+	// Standard Python script metadata: install the requested Python, and
+	// let uv resolve dependencies into a cached environment
+	if cfg.Python != nil {
+		l.Packages = append(append([]string(nil), l.Packages...), cfg.Python.Packages()...)
+		if len(cfg.Python.Dependencies) > 0 {
+			if l.Environment == nil {
+				l.Environment = map[string]string{}
+			}
+			l.Environment["UV_PYTHON_DOWNLOADS"] = "never"
+			l.Caches = append(append([]string(nil), l.Caches...), "uv")
+		}
+	}
+
+	// Artifacts are relative to the script, like its working directory
+	if cfg.Artifacts != "" {
+		l.OutputDir = cfg.Artifacts
+		if !filepath.IsAbs(l.OutputDir) {
+			l.OutputDir = filepath.Join(filepath.Dir(scriptPath), l.OutputDir)
+		}
+	}
+
+	return l
+}
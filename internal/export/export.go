@@ -0,0 +1,205 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"github.com/joshrwolf/apko-shell/internal/runtime"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats an environment can be exported in
+const (
+	FormatApko         = "apko"
+	FormatDockerfile   = "dockerfile"
+	FormatDevcontainer = "devcontainer"
+)
+
+// Formats returns the supported export formats
+func Formats() []string {
+	return []string{FormatApko, FormatDockerfile, FormatDevcontainer}
+}
+
+// scriptDir is where exported images install the script
+const scriptDir = "/usr/local/bin"
+
+// invalidRefChars matches characters not allowed in an image repository
+var invalidRefChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// Environment is a resolved apko-shell environment
+type Environment struct {
+	// Name of the environment, the script's file name when there is one
+	Name string
+
+	// Script file name, relative to the Dockerfile's build context; empty
+	// without a script
+	Script string
+
+	// Image configuration, as apko-shell builds it but without the account
+	// of the host user
+	Image *types.ImageConfiguration
+
+	// Reference the image built from Image is tagged with
+	ImageRef string
+
+	// Command running the script
+	Interpreter []string
+
+	// Ports the environment publishes
+	Ports []runtime.PortMapping
+}
+
+// ImageRef returns the default image reference for an environment named
+// name, such as apko-shell-hello:latest for hello.sh
+func ImageRef(name string) string {
+	base := strings.TrimSuffix(name, path.Ext(name))
+	base = strings.Trim(invalidRefChars.ReplaceAllString(strings.ToLower(base), "-"), "-._")
+	if base == "" {
+		return "apko-shell:latest"
+	}
+	return "apko-shell-" + base + ":latest"
+}
+
+// Export renders env in format
+func Export(env Environment, format string) ([]byte, error) {
+	switch format {
+	case FormatApko:
+		return apkoConfig(env)
+	case FormatDockerfile:
+		return dockerfile(env), nil
+	case FormatDevcontainer:
+		return devcontainer(env)
+	}
+	return nil, fmt.Errorf("unknown export format %q, expected one of %s", format, strings.Join(Formats(), ", "))
+}
+
+// apkoConfig renders the image configuration as a standalone apko file
+func apkoConfig(env Environment) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# apko configuration of %s, exported by apko-shell\n", env.Name)
+	fmt.Fprintf(&buf, "# Build with: apko build apko.yaml %s image.tar\n", env.ImageRef)
+
+	// Encoding through a node keeps apko's redaction of repository URLs
+	var doc yaml.Node
+	if err := doc.Encode(env.Image); err != nil {
+		return nil, fmt.Errorf("encoding image configuration: %w", err)
+	}
+	prune(&doc, "")
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("encoding image configuration: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding image configuration: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// prune drops the unset fields of an encoded image configuration, whose
+// types don't all omit them, and writes permissions in octal. path is the
+// dotted path of n, with list items named after the list.
+func prune(n *yaml.Node, path string) {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, item := range n.Content {
+			prune(item, path)
+		}
+	case yaml.MappingNode:
+		content := n.Content[:0]
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			field := strings.TrimPrefix(path+"."+key.Value, ".")
+			prune(value, field)
+			if unset(value, field) {
+				continue
+			}
+			if field == "paths.permissions" && value.Tag == "!!int" {
+				if mode, err := strconv.ParseUint(value.Value, 10, 32); err == nil {
+					value.Value = fmt.Sprintf("0o%o", mode)
+				}
+			}
+			content = append(content, key, value)
+		}
+		n.Content = content
+	}
+}
+
+// unset reports whether the encoded value of field is a zero value. Only
+// a user's gid distinguishes 0 from unset.
+func unset(n *yaml.Node, field string) bool {
+	switch {
+	case n.Kind == yaml.MappingNode || n.Kind == yaml.SequenceNode:
+		return len(n.Content) == 0
+	case n.Tag == "!!null", n.Tag == "!!str" && n.Value == "", n.Tag == "!!bool" && n.Value == "false":
+		return true
+	case n.Tag == "!!int" && n.Value == "0":
+		return field != "accounts.users.gid"
+	}
+	return false
+}
+
+// dockerfile renders a Dockerfile adding the script to the built image
+func dockerfile(env Environment) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Dockerfile for %s, exported by apko-shell. Build the base image first:\n", env.Name)
+	fmt.Fprintf(&buf, "#   apko-shell export %s --format apko > apko.yaml\n", env.Name)
+	fmt.Fprintf(&buf, "#   apko build apko.yaml %s image.tar && docker load < image.tar\n", env.ImageRef)
+	fmt.Fprintf(&buf, "FROM %s\n", env.ImageRef)
+
+	if env.Script != "" {
+		target := path.Join(scriptDir, path.Base(env.Script))
+		fmt.Fprintf(&buf, "COPY %s %s\n", env.Script, target)
+	}
+	fmt.Fprintf(&buf, "WORKDIR %s\n", runtime.WorkspacePath)
+	for _, pm := range env.Ports {
+		protocol := pm.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		fmt.Fprintf(&buf, "EXPOSE %d/%s\n", pm.ContainerPort, protocol)
+	}
+
+	if env.Script != "" {
+		entrypoint := append(append([]string(nil), env.Interpreter...), path.Join(scriptDir, path.Base(env.Script)))
+		args, _ := json.Marshal(entrypoint)
+		fmt.Fprintf(&buf, "ENTRYPOINT %s\n", args)
+	}
+	return buf.Bytes()
+}
+
+// devcontainerConfig is the subset of devcontainer.json apko-shell sets
+type devcontainerConfig struct {
+	Name            string   `json:"name"`
+	Image           string   `json:"image"`
+	WorkspaceMount  string   `json:"workspaceMount"`
+	WorkspaceFolder string   `json:"workspaceFolder"`
+	ForwardPorts    []uint16 `json:"forwardPorts,omitempty"`
+}
+
+// devcontainer renders a devcontainer.json using the built image, with the
+// workspace mounted where apko-shell mounts it
+func devcontainer(env Environment) ([]byte, error) {
+	cfg := devcontainerConfig{
+		Name:            env.Name,
+		Image:           env.ImageRef,
+		WorkspaceMount:  "source=${localWorkspaceFolder},target=" + runtime.WorkspacePath + ",type=bind",
+		WorkspaceFolder: runtime.WorkspacePath,
+	}
+	for _, pm := range env.Ports {
+		cfg.ForwardPorts = append(cfg.ForwardPorts, pm.ContainerPort)
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding devcontainer.json: %w", err)
+	}
+	return append(data, '\n'), nil
+}
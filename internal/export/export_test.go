@@ -0,0 +1,137 @@
+package export
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"github.com/joshrwolf/apko-shell/internal/runtime"
+	"gopkg.in/yaml.v3"
+)
+
+func testEnvironment() Environment {
+	img := &types.ImageConfiguration{Cmd: "/bin/sh"}
+	img.Contents.Packages = []string{"busybox", "python3"}
+	img.Contents.RuntimeRepositories = []string{"https://packages.wolfi.dev/os"}
+	img.Environment = map[string]string{"TZ": "UTC"}
+	img.Paths = []types.PathMutation{{Path: "/data", Type: "directory", Permissions: 0o755}}
+
+	return Environment{
+		Name:        "serve.py",
+		Script:      "serve.py",
+		Image:       img,
+		ImageRef:    ImageRef("serve.py"),
+		Interpreter: []string{"python3"},
+		Ports:       []runtime.PortMapping{{HostPort: 8080, ContainerPort: 8000}, {HostPort: 53, ContainerPort: 53, Protocol: "udp"}},
+	}
+}
+
+func TestImageRef(t *testing.T) {
+	tests := map[string]string{
+		"hello.sh":       "apko-shell-hello:latest",
+		"My Tool.py":     "apko-shell-my-tool:latest",
+		"build.test.sh":  "apko-shell-build.test:latest",
+		"":               "apko-shell:latest",
+		"apko-shell.sh":  "apko-shell-apko-shell:latest",
+		"__init__.py":    "apko-shell-init:latest",
+		"UPPER_CASE.SH":  "apko-shell-upper_case:latest",
+		"weird!!name.rb": "apko-shell-weird-name:latest",
+	}
+	for name, want := range tests {
+		if got := ImageRef(name); got != want {
+			t.Errorf("ImageRef(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestExportApko(t *testing.T) {
+	data, err := Export(testEnvironment(), FormatApko)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	var got types.ImageConfiguration
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatalf("exported configuration doesn't parse: %v\n%s", err, data)
+	}
+	if strings.Join(got.Contents.Packages, " ") != "busybox python3" {
+		t.Errorf("Packages = %v, want [busybox python3]", got.Contents.Packages)
+	}
+	if strings.Join(got.Contents.RuntimeRepositories, " ") != "https://packages.wolfi.dev/os" {
+		t.Errorf("Repositories = %v", got.Contents.RuntimeRepositories)
+	}
+	if got.Environment["TZ"] != "UTC" || got.Cmd != "/bin/sh" {
+		t.Errorf("Environment = %v, Cmd = %q", got.Environment, got.Cmd)
+	}
+	if len(got.Paths) != 1 || got.Paths[0].Permissions != 0o755 {
+		t.Errorf("Paths = %+v, want /data with 0o755", got.Paths)
+	}
+
+	// Unset fields are left out, and modes are written as such
+	for _, noise := range []string{"run-as", "source:", "uid:", "recursive", "accounts", "entrypoint"} {
+		if strings.Contains(string(data), noise) {
+			t.Errorf("exported configuration contains %q:\n%s", noise, data)
+		}
+	}
+	if !strings.Contains(string(data), "permissions: 0o755") {
+		t.Errorf("permissions not written in octal:\n%s", data)
+	}
+}
+
+func TestExportDockerfile(t *testing.T) {
+	data, err := Export(testEnvironment(), FormatDockerfile)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	var instructions []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") {
+			instructions = append(instructions, line)
+		}
+	}
+	want := []string{
+		"FROM apko-shell-serve:latest",
+		"COPY serve.py /usr/local/bin/serve.py",
+		"WORKDIR /workspace",
+		"EXPOSE 8000/tcp",
+		"EXPOSE 53/udp",
+		`ENTRYPOINT ["python3","/usr/local/bin/serve.py"]`,
+	}
+	if strings.Join(instructions, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Dockerfile instructions =\n%s\nwant\n%s", strings.Join(instructions, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Without a script the image's own command runs
+	env := testEnvironment()
+	env.Script = ""
+	data, _ = Export(env, FormatDockerfile)
+	if strings.Contains(string(data), "COPY") || strings.Contains(string(data), "ENTRYPOINT") {
+		t.Errorf("Dockerfile without a script =\n%s", data)
+	}
+}
+
+func TestExportDevcontainer(t *testing.T) {
+	data, err := Export(testEnvironment(), FormatDevcontainer)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	var got devcontainerConfig
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("devcontainer.json doesn't parse: %v", err)
+	}
+	if got.Image != "apko-shell-serve:latest" || got.WorkspaceFolder != "/workspace" {
+		t.Errorf("devcontainer = %+v", got)
+	}
+	if len(got.ForwardPorts) != 2 || got.ForwardPorts[0] != 8000 {
+		t.Errorf("ForwardPorts = %v, want [8000 53]", got.ForwardPorts)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	if _, err := Export(testEnvironment(), "nix"); err == nil {
+		t.Error("Export(nix) error = nil, want error")
+	}
+}
@@ -0,0 +1,195 @@
+package index
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/joshrwolf/apko-shell/internal/builder"
+)
+
+// Match ranks, best first
+const (
+	MatchName = iota
+	MatchNamePrefix
+	MatchCommand
+	MatchNameContains
+	MatchCommandContains
+	MatchDescription
+)
+
+// Result is a package matching a search
+type Result struct {
+	builder.Package
+
+	// Rank is how the package matched, one of the Match constants
+	Rank int `json:"rank"`
+}
+
+// Commands returns the commands a package provides, from its "cmd:"
+// provides
+func Commands(p builder.Package) []string {
+	var cmds []string
+	for _, provide := range p.Provides {
+		name, ok := strings.CutPrefix(provide, "cmd:")
+		if !ok {
+			continue
+		}
+		// Provides may carry a version, as in "cmd:git=2.45.0-r0"
+		if i := strings.IndexAny(name, "=<>~"); i >= 0 {
+			name = name[:i]
+		}
+		cmds = append(cmds, name)
+	}
+	return cmds
+}
+
+// Search returns the packages whose name, provided commands or description
+// contain term, ignoring case. Results are ordered by rank, then name.
+func Search(pkgs []builder.Package, term string) []Result {
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" {
+		return nil
+	}
+
+	var results []Result
+	for _, p := range pkgs {
+		if rank, ok := match(p, term); ok {
+			results = append(results, Result{Package: p, Rank: rank})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank < results[j].Rank
+		}
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// match returns the best rank at which p matches a lowercase term
+func match(p builder.Package, term string) (int, bool) {
+	name := strings.ToLower(p.Name)
+	switch {
+	case name == term:
+		return MatchName, true
+	case strings.HasPrefix(name, term):
+		return MatchNamePrefix, true
+	}
+
+	cmds := Commands(p)
+	for _, cmd := range cmds {
+		if strings.ToLower(cmd) == term {
+			return MatchCommand, true
+		}
+	}
+	if strings.Contains(name, term) {
+		return MatchNameContains, true
+	}
+	for _, cmd := range cmds {
+		if strings.Contains(strings.ToLower(cmd), term) {
+			return MatchCommandContains, true
+		}
+	}
+	if strings.Contains(strings.ToLower(p.Description), term) {
+		return MatchDescription, true
+	}
+	return 0, false
+}
+
+// Providers returns the packages providing command. A package named after
+// the command comes first, the others follow by name.
+func Providers(pkgs []builder.Package, command string) []builder.Package {
+	var providers []builder.Package
+	for _, p := range pkgs {
+		if slices.Contains(Commands(p), command) {
+			providers = append(providers, p)
+		}
+	}
+
+	sort.SliceStable(providers, func(i, j int) bool {
+		if exact := providers[i].Name == command; exact != (providers[j].Name == command) {
+			return exact
+		}
+		return providers[i].Name < providers[j].Name
+	})
+	return providers
+}
+
+// CommandTable maps every provided command to the names of its providers,
+// ordered as by Providers
+func CommandTable(pkgs []builder.Package) map[string][]string {
+	table := map[string][]string{}
+	for _, p := range pkgs {
+		for _, cmd := range Commands(p) {
+			if !slices.Contains(table[cmd], p.Name) {
+				table[cmd] = append(table[cmd], p.Name)
+			}
+		}
+	}
+
+	for cmd, names := range table {
+		sort.SliceStable(names, func(i, j int) bool {
+			if exact := names[i] == cmd; exact != (names[j] == cmd) {
+				return exact
+			}
+			return names[i] < names[j]
+		})
+	}
+	return table
+}
+
+// Resolution is the package chosen to provide a command
+type Resolution struct {
+	Command string `json:"command"`
+
+	// Package to install; empty when the command is already installed,
+	// ambiguous or unresolved
+	Package string `json:"package,omitempty"`
+
+	// Installed package already providing the command
+	Installed string `json:"installed,omitempty"`
+
+	// Every package providing the command, as ordered by Providers
+	Providers []string `json:"providers,omitempty"`
+}
+
+// Ambiguous reports whether several packages provide the command and none
+// is preferred
+func (r Resolution) Ambiguous() bool {
+	return r.Package == "" && r.Installed == "" && len(r.Providers) > 1
+}
+
+// Unresolved reports whether no package provides the command
+func (r Resolution) Unresolved() bool {
+	return r.Installed == "" && len(r.Providers) == 0
+}
+
+// ResolveCommands chooses packages from available to provide commands.
+// Commands provided by an installed package need nothing more; otherwise a
+// package named after the command, or the only provider, is chosen.
+func ResolveCommands(available, installed []builder.Package, commands []string) []Resolution {
+	table := CommandTable(available)
+
+	resolutions := make([]Resolution, 0, len(commands))
+	for _, cmd := range commands {
+		r := Resolution{Command: cmd, Providers: table[cmd]}
+		for _, p := range installed {
+			if slices.Contains(Commands(p), cmd) {
+				r.Installed = p.Name
+				break
+			}
+		}
+		if r.Installed == "" {
+			switch {
+			case slices.Contains(r.Providers, cmd):
+				r.Package = cmd
+			case len(r.Providers) == 1:
+				r.Package = r.Providers[0]
+			}
+		}
+		resolutions = append(resolutions, r)
+	}
+	return resolutions
+}
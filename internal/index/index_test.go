@@ -0,0 +1,119 @@
+package index
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/joshrwolf/apko-shell/internal/builder"
+)
+
+var testPackages = []builder.Package{
+	{Name: "git", Description: "Distributed version control system", Provides: []string{"cmd:git=2.45.0-r0", "cmd:git-shell=2.45.0-r0"}},
+	{Name: "git-lfs", Description: "Git extension for versioning large files", Provides: []string{"cmd:git-lfs"}},
+	{Name: "gitsign", Description: "Keyless Git signing with Sigstore"},
+	{Name: "jq", Description: "A lightweight and flexible command-line JSON processor", Provides: []string{"cmd:jq"}},
+	{Name: "py3-pip", Description: "Tool for installing Python packages", Provides: []string{"cmd:pip", "cmd:pip3", "py3.12:pip"}},
+	{Name: "python-3.12", Description: "the Python programming language", Provides: []string{"cmd:python3.12"}},
+	{Name: "legit", Description: "Complementary command-line interface for Git"},
+}
+
+func TestCommands(t *testing.T) {
+	got := Commands(testPackages[4])
+	if strings.Join(got, " ") != "pip pip3" {
+		t.Errorf("Commands() = %v, want [pip pip3]", got)
+	}
+
+	got = Commands(testPackages[0])
+	if strings.Join(got, " ") != "git git-shell" {
+		t.Errorf("Commands() = %v, want [git git-shell]", got)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		term string
+		want []string
+	}{
+		{term: "git", want: []string{"git", "git-lfs", "gitsign", "legit"}},
+		{term: "GIT-", want: []string{"git-lfs", "git"}},
+		{term: "pip", want: []string{"py3-pip"}},
+		{term: "python", want: []string{"python-3.12", "py3-pip"}},
+		{term: "json", want: []string{"jq"}},
+		{term: "nothing-matches", want: nil},
+		{term: " ", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.term, func(t *testing.T) {
+			var got []string
+			for _, r := range Search(testPackages, tt.term) {
+				got = append(got, r.Name)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Search(%q) = %v, want %v", tt.term, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviders(t *testing.T) {
+	pkgs := append(slices.Clone(testPackages),
+		builder.Package{Name: "pip", Provides: []string{"cmd:pip"}},
+		builder.Package{Name: "py3.11-pip", Provides: []string{"cmd:pip"}},
+	)
+
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{command: "pip", want: []string{"pip", "py3-pip", "py3.11-pip"}},
+		{command: "git-shell", want: []string{"git"}},
+		{command: "python3", want: nil},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, p := range Providers(pkgs, tt.command) {
+			got = append(got, p.Name)
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("Providers(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+
+		table := CommandTable(pkgs)
+		if strings.Join(table[tt.command], " ") != strings.Join(tt.want, " ") {
+			t.Errorf("CommandTable()[%q] = %v, want %v", tt.command, table[tt.command], tt.want)
+		}
+	}
+}
+
+func TestResolveCommands(t *testing.T) {
+	available := append(slices.Clone(testPackages),
+		builder.Package{Name: "busybox", Provides: []string{"cmd:sort", "cmd:wc"}},
+		builder.Package{Name: "coreutils", Provides: []string{"cmd:sort", "cmd:wc", "cmd:tac"}},
+		builder.Package{Name: "py3.11-pip", Provides: []string{"cmd:pip"}},
+	)
+	installed := []builder.Package{available[len(available)-3]}
+
+	got := ResolveCommands(available, installed, []string{"jq", "sort", "tac", "pip", "nope"})
+
+	tests := []struct {
+		pkg, installed string
+		ambiguous      bool
+		unresolved     bool
+	}{
+		{pkg: "jq"},
+		{installed: "busybox"},
+		{pkg: "coreutils"},
+		{ambiguous: true},
+		{unresolved: true},
+	}
+	for i, tt := range tests {
+		r := got[i]
+		if r.Package != tt.pkg || r.Installed != tt.installed || r.Ambiguous() != tt.ambiguous || r.Unresolved() != tt.unresolved {
+			t.Errorf("ResolveCommands()[%q] = %+v (ambiguous %v, unresolved %v), want %+v",
+				r.Command, r, r.Ambiguous(), r.Unresolved(), tt)
+		}
+	}
+}
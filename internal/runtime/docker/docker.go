@@ -2,11 +2,15 @@ package docker
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/chainguard-dev/clog"
 	"github.com/joshrwolf/apko-shell/internal/runtime"
@@ -36,34 +40,159 @@ func (d *Docker) Run(ctx context.Context, opts runtime.RunOptions) error {
 	}
 	log.Debug("loaded image", "id", imageID)
 
+	// Stage secrets as read-only mounts
+	secretMounts, cleanup, err := stageSecrets(opts.Secrets)
+	if err != nil {
+		return fmt.Errorf("staging secrets: %w", err)
+	}
+	defer cleanup()
+	opts.Mounts = append(slices.Clone(opts.Mounts), secretMounts...)
+
+	// Keep the container around after it exits if we need to copy outputs from it
+	var name string
+	if opts.OutputDir != "" {
+		name = fmt.Sprintf("apko-shell-run-%d", time.Now().UnixNano())
+	}
+
 	// Build docker run command
-	args := d.buildRunArgs(opts, imageID)
+	args := d.buildRunArgs(opts, imageID, name)
 
 	// Create the command
 	cmd := exec.CommandContext(ctx, d.dockerPath, args...)
+	setIO(cmd, opts.Stdin, opts.Stdout, opts.Stderr)
+
+	// Run the container
+	log.Debug("running container", "args", args)
+	runErr := cmd.Run()
+
+	if name != "" {
+		return errors.Join(runErr, d.copyOutput(context.WithoutCancel(ctx), name, opts.OutputDir))
+	}
+	return runErr
+}
+
+// Describe implements runtime.Describer. Secrets are shown at the
+// directory they would be staged in.
+func (d *Docker) Describe(opts runtime.RunOptions, image string) []string {
+	opts.Mounts = slices.Clone(opts.Mounts)
+	stageDir, err := secretsTempDir()
+	if err != nil {
+		stageDir = "NO-TMPFS"
+	}
+	for _, secret := range opts.Secrets {
+		opts.Mounts = append(opts.Mounts, runtime.Mount{
+			Source:   filepath.Join(stageDir, "apko-shell-secrets-XXXX", secret.ID),
+			Target:   secret.Target(),
+			ReadOnly: true,
+		})
+	}
 
-	// Set up IO
-	if opts.Stdin != nil {
-		cmd.Stdin = opts.Stdin
+	var name string
+	if opts.OutputDir != "" {
+		name = "apko-shell-run-ID"
+	}
+
+	return append([]string{d.dockerPath}, d.buildRunArgs(opts, image, name)...)
+}
+
+// copyOutput copies the output directory out of a stopped container and
+// removes the container along with its output volume
+func (d *Docker) copyOutput(ctx context.Context, name, outputDir string) error {
+	log := clog.FromContext(ctx)
+
+	defer func() {
+		if output, err := exec.CommandContext(ctx, d.dockerPath, "rm", "-f", "-v", name).CombinedOutput(); err != nil {
+			log.Warn("failed to remove container", "name", name, "error", err, "output", string(output))
+		}
+	}()
+
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return fmt.Errorf("creating output dir: %w", err)
+	}
+
+	log.Debug("copying outputs", "container", name, "dest", outputDir)
+	cmd := exec.CommandContext(ctx, d.dockerPath, "cp", name+":"+runtime.OutputPath+"/.", outputDir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("copying outputs: %w, output: %s", err, string(output))
+	}
+
+	return nil
+}
+
+// Start implements runtime.Sessions
+func (d *Docker) Start(ctx context.Context, name string, opts runtime.RunOptions) (string, error) {
+	log := clog.FromContext(ctx)
+
+	imageID, err := d.loadImage(ctx, opts.ImagePath)
+	if err != nil {
+		return "", fmt.Errorf("loading image: %w", err)
+	}
+	log.Debug("loaded image", "id", imageID)
+
+	// Keep the image's default shell alive on a detached TTY
+	args := []string{"run", "-d", "-i", "-t", "--name", name}
+	args = append(args, d.containerArgs(opts)...)
+	args = append(args, imageID)
+
+	log.Debug("starting container", "args", args)
+	var stderr strings.Builder
+	cmd := exec.CommandContext(ctx, d.dockerPath, args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("docker run failed: %w, output: %s", err, stderr.String())
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Exec implements runtime.Sessions
+func (d *Docker) Exec(ctx context.Context, id string, opts runtime.ExecOptions) error {
+	log := clog.FromContext(ctx)
+
+	args := d.buildExecArgs(id, opts)
+	cmd := exec.CommandContext(ctx, d.dockerPath, args...)
+	setIO(cmd, opts.Stdin, opts.Stdout, opts.Stderr)
+
+	log.Debug("executing in container", "args", args)
+	return cmd.Run()
+}
+
+// Stop implements runtime.Sessions
+func (d *Docker) Stop(ctx context.Context, id string) error {
+	cmd := exec.CommandContext(ctx, d.dockerPath, "rm", "-f", id)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("docker rm failed: %w, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// Running implements runtime.Sessions
+func (d *Docker) Running(ctx context.Context, id string) bool {
+	cmd := exec.CommandContext(ctx, d.dockerPath, "inspect", "--format", "{{.State.Running}}", id)
+	output, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// setIO wires the given streams to cmd, defaulting to os.Std*
+func setIO(cmd *exec.Cmd, stdin io.Reader, stdout, stderr io.Writer) {
+	if stdin != nil {
+		cmd.Stdin = stdin
 	} else {
 		cmd.Stdin = os.Stdin
 	}
 
-	if opts.Stdout != nil {
-		cmd.Stdout = opts.Stdout
+	if stdout != nil {
+		cmd.Stdout = stdout
 	} else {
 		cmd.Stdout = os.Stdout
 	}
 
-	if opts.Stderr != nil {
-		cmd.Stderr = opts.Stderr
+	if stderr != nil {
+		cmd.Stderr = stderr
 	} else {
 		cmd.Stderr = os.Stderr
 	}
-
-	// Run the container
-	log.Debug("running container", "args", args)
-	return cmd.Run()
 }
 
 // loadImage loads an OCI tarball and returns the image ID
@@ -108,9 +237,15 @@ func (d *Docker) loadImage(ctx context.Context, tarPath string) (string, error)
 	return "", fmt.Errorf("could not parse image reference from docker load output: %s", outputStr)
 }
 
-// buildRunArgs builds the docker run arguments
-func (d *Docker) buildRunArgs(opts runtime.RunOptions, imageID string) []string {
-	args := []string{"run", "--rm"}
+// buildRunArgs builds the docker run arguments. Named containers are kept
+// after they exit; anonymous ones are removed.
+func (d *Docker) buildRunArgs(opts runtime.RunOptions, imageID, name string) []string {
+	args := []string{"run"}
+	if name != "" {
+		args = append(args, "--name", name)
+	} else {
+		args = append(args, "--rm")
+	}
 
 	// Always keep stdin open
 	args = append(args, "-i")
@@ -120,6 +255,39 @@ func (d *Docker) buildRunArgs(opts runtime.RunOptions, imageID string) []string
 		args = append(args, "-t")
 	}
 
+	if opts.Init {
+		args = append(args, "--init")
+	}
+
+	args = append(args, d.containerArgs(opts)...)
+
+	// Image
+	args = append(args, imageID)
+
+	// Command to run
+	if len(opts.Command) > 0 {
+		args = append(args, opts.Command...)
+	} else if opts.ScriptPath != "" && !opts.Interactive {
+		scriptName := opts.ScriptName
+		if scriptName == "" {
+			scriptName = runtime.ScriptMountPath(opts.ScriptPath)
+		}
+
+		// Run the unmodified script through its interpreter with its arguments
+		args = append(args, opts.Interpreter...)
+		args = append(args, scriptName)
+		args = append(args, opts.ScriptArgs...)
+	}
+	// If interactive, use the default entrypoint from the image
+
+	return args
+}
+
+// containerArgs builds the user, mount and environment arguments shared by
+// every container apko-shell creates
+func (d *Docker) containerArgs(opts runtime.RunOptions) []string {
+	var args []string
+
 	// User mapping - use current UID:GID
 	uid := os.Getuid()
 	gid := os.Getgid()
@@ -132,8 +300,17 @@ func (d *Docker) buildRunArgs(opts runtime.RunOptions, imageID string) []string
 		if err != nil {
 			absWorkDir = opts.WorkDir // fallback to original
 		}
-		args = append(args, "-v", fmt.Sprintf("%s:/workspace:rw", absWorkDir))
-		args = append(args, "-w", "/workspace")
+		mode := "rw"
+		if opts.Sandbox.ReadOnlyWorkDir {
+			mode = "ro"
+		}
+		args = append(args, "-v", fmt.Sprintf("%s:%s:%s", absWorkDir, runtime.WorkspacePath, mode))
+
+		containerWorkDir := opts.ContainerWorkDir
+		if containerWorkDir == "" {
+			containerWorkDir = runtime.WorkspacePath
+		}
+		args = append(args, "-w", containerWorkDir)
 	}
 
 	// Script mount (read-only)
@@ -143,7 +320,48 @@ func (d *Docker) buildRunArgs(opts runtime.RunOptions, imageID string) []string
 		if err != nil {
 			absPath = opts.ScriptPath // fallback to original
 		}
-		args = append(args, "-v", fmt.Sprintf("%s:/apko-shell/script:ro", absPath))
+		args = append(args, "-v", fmt.Sprintf("%s:%s:ro", absPath, runtime.ScriptMountPath(absPath)))
+	}
+
+	// Sandbox restrictions
+	if opts.Sandbox.ReadOnlyRootFS {
+		args = append(args, "--read-only", "--tmpfs", "/tmp")
+		for _, dir := range opts.Sandbox.TmpfsDirs {
+			args = append(args, "--tmpfs", fmt.Sprintf("%s:exec,mode=0755,uid=%d,gid=%d", dir, uid, gid))
+		}
+	}
+	if opts.Sandbox.DropCapabilities {
+		args = append(args, "--cap-drop", "ALL")
+	}
+	if opts.Sandbox.NoNewPrivileges {
+		args = append(args, "--security-opt", "no-new-privileges")
+	}
+	if opts.Sandbox.DisableNetwork {
+		args = append(args, "--network", "none")
+	}
+
+	// Additional mounts, along with the environment that makes them usable
+	for _, m := range opts.Mounts {
+		args = append(args, "--mount", mountArg(m))
+
+		switch m.Type {
+		case runtime.MountSSHAgent:
+			args = append(args, "-e", "SSH_AUTH_SOCK="+m.Target)
+		case runtime.MountGitConfig:
+			args = append(args, "-e", "GIT_CONFIG_GLOBAL="+m.Target)
+		}
+	}
+
+	// Outputs live in an anonymous volume so they survive a read-only root
+	// filesystem and can be copied out after the container exits
+	if opts.OutputDir != "" {
+		args = append(args, "--mount", "type=volume,target="+runtime.OutputPath)
+		args = append(args, "-e", "APKO_SHELL_OUT="+runtime.OutputPath)
+	}
+
+	// Published ports
+	for _, p := range opts.Ports {
+		args = append(args, "-p", p.String())
 	}
 
 	// Environment variables
@@ -151,16 +369,37 @@ func (d *Docker) buildRunArgs(opts runtime.RunOptions, imageID string) []string
 		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
 	}
 
-	// Image
-	args = append(args, imageID)
+	return args
+}
 
-	// Command to run
-	if opts.ScriptPath != "" && !opts.Interactive {
-		// Run the script with its arguments
-		args = append(args, "/apko-shell/script")
-		args = append(args, opts.ScriptArgs...)
+// mountArg formats a mount for docker's --mount flag
+func mountArg(m runtime.Mount) string {
+	source, err := filepath.Abs(m.Source)
+	if err != nil {
+		source = m.Source // fallback to original
 	}
-	// If interactive, use the default entrypoint from the image
+
+	arg := fmt.Sprintf("type=bind,source=%s,target=%s", source, m.Target)
+	if m.ReadOnly {
+		arg += ",readonly"
+	}
+	return arg
+}
+
+// buildExecArgs builds the docker exec arguments
+func (d *Docker) buildExecArgs(id string, opts runtime.ExecOptions) []string {
+	args := []string{"exec", "-i"}
+
+	if opts.Interactive {
+		args = append(args, "-t")
+	}
+
+	for k, v := range opts.Env {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
+	}
+
+	args = append(args, id)
+	args = append(args, opts.Command...)
 
 	return args
 }
@@ -3,9 +3,11 @@ package docker
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"chainguard.dev/apko/pkg/build/types"
@@ -90,3 +92,265 @@ echo "Args: $@"
 		t.Errorf("output missing args, got: %s", output)
 	}
 }
+
+func TestBuildRunArgs(t *testing.T) {
+	d := New()
+
+	opts := runtime.RunOptions{
+		ScriptPath: "/tmp/script.sh",
+		ScriptArgs: []string{"a", "b"},
+		WorkDir:    "/src",
+		Mounts: []runtime.Mount{
+			{Source: "/host/ctl", Target: "/apko-shell/control"},
+			{Source: "/host/helper", Target: "/usr/local/bin/helper", ReadOnly: true},
+			{Type: runtime.MountSSHAgent, Source: "/tmp/agent.sock", Target: runtime.SSHAgentSocketPath},
+			{Type: runtime.MountGitConfig, Source: "/home/me/.gitconfig", Target: runtime.GitConfigPath, ReadOnly: true},
+			{Source: "/home/me/.ssh/known_hosts", Target: runtime.KnownHostsPath, ReadOnly: true},
+		},
+		Ports: []runtime.PortMapping{
+			{HostPort: 8080, ContainerPort: 80},
+			{HostIP: "127.0.0.1", HostPort: 5353, ContainerPort: 53, Protocol: "udp"},
+		},
+		Init: true,
+	}
+
+	got := strings.Join(d.buildRunArgs(opts, "img", ""), " ")
+
+	for _, want := range []string{
+		"run --rm -i --init",
+		"-v /src:/workspace:rw -w /workspace",
+		"-v /tmp/script.sh:/apko-shell/script/script.sh:ro",
+		"--mount type=bind,source=/host/ctl,target=/apko-shell/control --mount type=bind,source=/host/helper,target=/usr/local/bin/helper,readonly",
+		"--mount type=bind,source=/tmp/agent.sock,target=/run/apko-shell/ssh-agent.sock -e SSH_AUTH_SOCK=/run/apko-shell/ssh-agent.sock",
+		"-e GIT_CONFIG_GLOBAL=/run/apko-shell/gitconfig",
+		"--mount type=bind,source=/home/me/.ssh/known_hosts,target=/etc/ssh/ssh_known_hosts,readonly",
+		"-p 8080:80 -p 127.0.0.1:5353:53/udp",
+		"img /apko-shell/script/script.sh a b",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("buildRunArgs() = %q, missing %q", got, want)
+		}
+	}
+
+	// Forwarding known hosts leaves the user's own ssh settings alone
+	if strings.Contains(got, "GIT_SSH_COMMAND") {
+		t.Errorf("buildRunArgs() = %q, unexpected GIT_SSH_COMMAND", got)
+	}
+}
+
+func TestStageSecrets(t *testing.T) {
+	t.Setenv("APKO_SHELL_TEST_TOKEN", "s3cr3t")
+
+	srcFile := filepath.Join(t.TempDir(), "npmrc")
+	if err := os.WriteFile(srcFile, []byte("registry"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	mounts, cleanup, err := stageSecrets([]runtime.Secret{
+		{ID: "npmrc", Source: srcFile},
+		{ID: "token", Env: "APKO_SHELL_TEST_TOKEN"},
+	})
+	if err != nil {
+		t.Fatalf("stageSecrets() error = %v", err)
+	}
+
+	if len(mounts) != 2 {
+		t.Fatalf("stageSecrets() got %d mounts, want 2", len(mounts))
+	}
+
+	// File secrets are staged like env secrets rather than mounted in place
+	if mounts[0].Source == srcFile || mounts[0].Target != "/run/secrets/npmrc" || !mounts[0].ReadOnly {
+		t.Errorf("file secret mount = %+v", mounts[0])
+	}
+	if data, err := os.ReadFile(mounts[0].Source); err != nil || string(data) != "registry" {
+		t.Errorf("staged file secret = %q, %v; want %q", data, err, "registry")
+	}
+
+	// Env secrets are staged to a file with the value
+	if mounts[1].Target != "/run/secrets/token" || !mounts[1].ReadOnly {
+		t.Errorf("env secret mount = %+v", mounts[1])
+	}
+	data, err := os.ReadFile(mounts[1].Source)
+	if err != nil || string(data) != "s3cr3t" {
+		t.Errorf("staged secret = %q, %v; want %q", data, err, "s3cr3t")
+	}
+
+	// Cleanup removes staged values, and only those
+	cleanup()
+	if _, err := os.Stat(mounts[1].Source); !os.IsNotExist(err) {
+		t.Errorf("staged secret still exists after cleanup: %v", err)
+	}
+	if _, err := os.Stat(srcFile); err != nil {
+		t.Errorf("cleanup removed the secret's source: %v", err)
+	}
+
+	// Missing sources are reported
+	if _, _, err := stageSecrets([]runtime.Secret{{ID: "x", Env: "APKO_SHELL_TEST_UNSET"}}); err == nil {
+		t.Error("stageSecrets() with unset env succeeded, want error")
+	}
+
+	// Secrets are never staged on disk
+	defer func(dirs []string) { tmpfsDirs = dirs }(tmpfsDirs)
+	tmpfsDirs = []string{filepath.Join(t.TempDir(), "missing"), "$APKO_SHELL_TEST_UNSET"}
+	if _, _, err := stageSecrets([]runtime.Secret{{ID: "token", Env: "APKO_SHELL_TEST_TOKEN"}}); err == nil || !strings.Contains(err.Error(), "no tmpfs") {
+		t.Errorf("stageSecrets() without a tmpfs error = %v, want no tmpfs", err)
+	}
+}
+
+func TestBuildRunArgsCommand(t *testing.T) {
+	d := New()
+
+	opts := runtime.RunOptions{
+		ScriptPath:  "/tmp/script.sh",
+		Interactive: true,
+		Command:     []string{"/bin/sh", "-c", "exec /bin/sh"},
+	}
+
+	got := d.buildRunArgs(opts, "img", "")
+	if tail := strings.Join(got[len(got)-4:], " "); tail != "img /bin/sh -c exec /bin/sh" {
+		t.Errorf("buildRunArgs() ends with %q, want the command after the image", tail)
+	}
+}
+
+func TestBuildRunArgsOutputDir(t *testing.T) {
+	d := New()
+
+	opts := runtime.RunOptions{
+		ScriptPath: "/tmp/script.sh",
+		OutputDir:  "/tmp/out",
+	}
+
+	got := strings.Join(d.buildRunArgs(opts, "img", "apko-shell-run-1"), " ")
+
+	if strings.Contains(got, "--rm") {
+		t.Errorf("buildRunArgs() = %q, named container must not be removed on exit", got)
+	}
+	for _, want := range []string{
+		"run --name apko-shell-run-1",
+		"--mount type=volume,target=/apko-shell/out",
+		"-e APKO_SHELL_OUT=/apko-shell/out",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("buildRunArgs() = %q, missing %q", got, want)
+		}
+	}
+}
+
+func TestBuildRunArgsSandbox(t *testing.T) {
+	d := New()
+
+	opts := runtime.RunOptions{
+		WorkDir: "/src",
+		Sandbox: runtime.Sandbox{
+			ReadOnlyWorkDir:  true,
+			ReadOnlyRootFS:   true,
+			TmpfsDirs:        []string{"/home/user"},
+			DropCapabilities: true,
+			NoNewPrivileges:  true,
+			DisableNetwork:   true,
+		},
+	}
+
+	got := strings.Join(d.buildRunArgs(opts, "img", ""), " ")
+
+	for _, want := range []string{
+		"-v /src:/workspace:ro",
+		"--read-only --tmpfs /tmp",
+		fmt.Sprintf("--tmpfs /home/user:exec,mode=0755,uid=%d,gid=%d", os.Getuid(), os.Getgid()),
+		"--cap-drop ALL",
+		"--security-opt no-new-privileges",
+		"--network none",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("buildRunArgs() = %q, missing %q", got, want)
+		}
+	}
+
+	// No restrictions by default
+	got = strings.Join(d.buildRunArgs(runtime.RunOptions{WorkDir: "/src"}, "img", ""), " ")
+	for _, unwanted := range []string{"--read-only", "--cap-drop", "--security-opt", "--network", ":ro"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("buildRunArgs() = %q, unexpected %q", got, unwanted)
+		}
+	}
+}
+
+func TestBuildRunArgsInterpreter(t *testing.T) {
+	d := New()
+
+	opts := runtime.RunOptions{
+		ScriptPath:  "/src/scripts/build.sh",
+		ScriptName:  "./scripts/build.sh",
+		Interpreter: []string{"/bin/bash"},
+		ScriptArgs:  []string{"--release"},
+		WorkDir:     "/src",
+	}
+
+	got := strings.Join(d.buildRunArgs(opts, "img", ""), " ")
+
+	for _, want := range []string{
+		"-v /src/scripts/build.sh:/apko-shell/script/build.sh:ro",
+		"img /bin/bash ./scripts/build.sh --release",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("buildRunArgs() = %q, missing %q", got, want)
+		}
+	}
+}
+
+func TestBuildRunArgsScriptName(t *testing.T) {
+	d := New()
+
+	// Scripts outside the workspace run by their mount path, which keeps
+	// the file name for interpreters that check it
+	opts := runtime.RunOptions{
+		ScriptPath:  "/home/me/hello.go",
+		Interpreter: []string{"go", "run"},
+	}
+
+	got := strings.Join(d.buildRunArgs(opts, "img", ""), " ")
+
+	for _, want := range []string{
+		"-v /home/me/hello.go:/apko-shell/script/hello.go:ro",
+		"img go run /apko-shell/script/hello.go",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("buildRunArgs() = %q, missing %q", got, want)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	d := New()
+
+	opts := runtime.RunOptions{
+		ScriptPath: "/src/build.sh",
+		WorkDir:    "/src",
+		Secrets: []runtime.Secret{
+			{ID: "npmrc", Source: "/home/me/.npmrc"},
+			{ID: "token", Env: "GITHUB_TOKEN"},
+		},
+		OutputDir: "/src/dist",
+	}
+
+	got := strings.Join(d.Describe(opts, "IMAGE"), " ")
+
+	for _, want := range []string{
+		"docker run --name apko-shell-run-ID",
+		"apko-shell-secrets-XXXX/npmrc,target=/run/secrets/npmrc",
+		"apko-shell-secrets-XXXX/token,target=/run/secrets/token",
+		"IMAGE /apko-shell/script/build.sh",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Describe() = %q, missing %q", got, want)
+		}
+	}
+
+	if strings.Contains(got, "/home/me/.npmrc") {
+		t.Errorf("Describe() = %q, file secrets must be staged, not mounted in place", got)
+	}
+
+	if len(opts.Mounts) != 0 {
+		t.Errorf("Describe() modified the caller's mounts: %v", opts.Mounts)
+	}
+}
@@ -0,0 +1,76 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joshrwolf/apko-shell/internal/runtime"
+)
+
+// stageSecrets prepares read-only bind mounts for secrets. Their values,
+// read from files or the environment, are written to a private directory
+// on a host tmpfs, so that they never reach disk, the image, or the
+// container's configuration, and host files are never mounted into the
+// container. Without a tmpfs, staging fails. The returned cleanup function
+// removes anything that was staged.
+func stageSecrets(secrets []runtime.Secret) ([]runtime.Mount, func(), error) {
+	var mounts []runtime.Mount
+	var stageDir string
+
+	cleanup := func() {
+		if stageDir != "" {
+			os.RemoveAll(stageDir)
+		}
+	}
+
+	for _, secret := range secrets {
+		value, err := secret.Value()
+		if err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+
+		if stageDir == "" {
+			dir, err := secretsTempDir()
+			if err != nil {
+				return nil, nil, err
+			}
+			stageDir, err = os.MkdirTemp(dir, "apko-shell-secrets-*")
+			if err != nil {
+				return nil, nil, fmt.Errorf("creating secrets dir: %w", err)
+			}
+		}
+
+		path := filepath.Join(stageDir, secret.ID)
+		if err := os.WriteFile(path, value, 0o400); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("secret %s: %w", secret.ID, err)
+		}
+		mounts = append(mounts, runtime.Mount{
+			Source:   path,
+			Target:   secret.Target(),
+			ReadOnly: true,
+		})
+	}
+
+	return mounts, cleanup, nil
+}
+
+// tmpfsDirs are host directories backed by memory, in order of preference
+var tmpfsDirs = []string{"/dev/shm", "$XDG_RUNTIME_DIR"}
+
+// secretsTempDir returns the host tmpfs directory to stage secrets in
+func secretsTempDir() (string, error) {
+	for _, dir := range tmpfsDirs {
+		dir = os.ExpandEnv(dir)
+		if dir == "" {
+			continue
+		}
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("no tmpfs to stage secrets in, tried %s", strings.Join(tmpfsDirs, ", "))
+}
@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortMapping publishes a container port on the host
+type PortMapping struct {
+	// Host interface to bind (optional, defaults to all interfaces)
+	HostIP string
+
+	// Port on the host
+	HostPort uint16
+
+	// Port inside the container
+	ContainerPort uint16
+
+	// Protocol, "tcp" or "udp" (optional, defaults to tcp)
+	Protocol string
+}
+
+// ParsePortMapping parses a port mapping of the form
+// [[hostIP:]hostPort:]containerPort[/protocol]. A bare container port is
+// published on the same host port. IPv6 host IPs are written in brackets,
+// as in [::1]:8080:80.
+func ParsePortMapping(s string) (PortMapping, error) {
+	var pm PortMapping
+
+	spec := s
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		pm.Protocol = strings.ToLower(spec[i+1:])
+		spec = spec[:i]
+		if pm.Protocol != "tcp" && pm.Protocol != "udp" {
+			return PortMapping{}, fmt.Errorf("invalid port mapping %q: unsupported protocol %q", s, pm.Protocol)
+		}
+	}
+
+	// A bracketed host IP contains colons of its own, so take it off first
+	if rest, ok := strings.CutPrefix(spec, "["); ok {
+		ip, ports, ok := strings.Cut(rest, "]:")
+		if !ok || ip == "" || strings.Count(ports, ":") != 1 {
+			return PortMapping{}, fmt.Errorf("invalid port mapping %q: expected [hostIP]:hostPort:containerPort[/protocol]", s)
+		}
+		pm.HostIP, spec = ip, ports
+	}
+
+	parts := strings.Split(spec, ":")
+	var hostPort, containerPort string
+	switch len(parts) {
+	case 1:
+		hostPort, containerPort = parts[0], parts[0]
+	case 2:
+		hostPort, containerPort = parts[0], parts[1]
+	case 3:
+		if pm.HostIP != "" {
+			return PortMapping{}, fmt.Errorf("invalid port mapping %q: expected [hostIP]:hostPort:containerPort[/protocol]", s)
+		}
+		pm.HostIP, hostPort, containerPort = parts[0], parts[1], parts[2]
+	default:
+		return PortMapping{}, fmt.Errorf("invalid port mapping %q: expected [[hostIP:]hostPort:]containerPort[/protocol]", s)
+	}
+
+	var err error
+	if pm.HostPort, err = parsePort(hostPort); err != nil {
+		return PortMapping{}, fmt.Errorf("invalid port mapping %q: host port: %w", s, err)
+	}
+	if pm.ContainerPort, err = parsePort(containerPort); err != nil {
+		return PortMapping{}, fmt.Errorf("invalid port mapping %q: container port: %w", s, err)
+	}
+
+	return pm, nil
+}
+
+// String formats the mapping in the same form ParsePortMapping accepts
+func (pm PortMapping) String() string {
+	s := fmt.Sprintf("%d:%d", pm.HostPort, pm.ContainerPort)
+	switch {
+	case strings.Contains(pm.HostIP, ":"):
+		s = "[" + pm.HostIP + "]:" + s
+	case pm.HostIP != "":
+		s = pm.HostIP + ":" + s
+	}
+	if pm.Protocol != "" {
+		s += "/" + pm.Protocol
+	}
+	return s
+}
+
+func parsePort(s string) (uint16, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || port == 0 {
+		return 0, fmt.Errorf("%q is not a valid port number", s)
+	}
+	return uint16(port), nil
+}
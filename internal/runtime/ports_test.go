@@ -0,0 +1,97 @@
+package runtime
+
+import "testing"
+
+func TestParsePortMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    PortMapping
+		wantErr bool
+	}{
+		{
+			name: "container port only",
+			spec: "8000",
+			want: PortMapping{HostPort: 8000, ContainerPort: 8000},
+		},
+		{
+			name: "host and container port",
+			spec: "8080:80",
+			want: PortMapping{HostPort: 8080, ContainerPort: 80},
+		},
+		{
+			name: "host ip",
+			spec: "127.0.0.1:5432:5432",
+			want: PortMapping{HostIP: "127.0.0.1", HostPort: 5432, ContainerPort: 5432},
+		},
+		{
+			name: "ipv6 host ip",
+			spec: "[::1]:8080:80",
+			want: PortMapping{HostIP: "::1", HostPort: 8080, ContainerPort: 80},
+		},
+		{
+			name: "ipv6 host ip and protocol",
+			spec: "[fe80::1]:5353:53/udp",
+			want: PortMapping{HostIP: "fe80::1", HostPort: 5353, ContainerPort: 53, Protocol: "udp"},
+		},
+		{
+			name:    "unbracketed ipv6 host ip",
+			spec:    "::1:8080:80",
+			wantErr: true,
+		},
+		{
+			name:    "ipv6 host ip without host port",
+			spec:    "[::1]:80",
+			wantErr: true,
+		},
+		{
+			name:    "unclosed bracket",
+			spec:    "[::1:8080:80",
+			wantErr: true,
+		},
+		{
+			name: "protocol",
+			spec: "5353:53/udp",
+			want: PortMapping{HostPort: 5353, ContainerPort: 53, Protocol: "udp"},
+		},
+		{
+			name:    "unsupported protocol",
+			spec:    "80/sctp",
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			spec:    "http:80",
+			wantErr: true,
+		},
+		{
+			name:    "out of range",
+			spec:    "70000:80",
+			wantErr: true,
+		},
+		{
+			name:    "too many parts",
+			spec:    "a:b:80:80",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePortMapping(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePortMapping(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePortMapping(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+
+			// String round-trips through ParsePortMapping
+			if !tt.wantErr {
+				if again, err := ParsePortMapping(got.String()); err != nil || again != got {
+					t.Errorf("ParsePortMapping(%q) = %+v, %v; want %+v", got.String(), again, err, got)
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package runtime
 import (
 	"context"
 	"io"
+	"path"
+	"path/filepath"
 )
 
 // Runtime executes containers from OCI image tarballs
@@ -11,23 +13,176 @@ type Runtime interface {
 	Run(ctx context.Context, opts RunOptions) error
 }
 
+// Sessions manages long-lived containers that outlive a single invocation
+type Sessions interface {
+	// Start launches a detached container with the given name and returns its ID
+	Start(ctx context.Context, name string, opts RunOptions) (string, error)
+
+	// Exec runs a command inside a started container
+	Exec(ctx context.Context, id string, opts ExecOptions) error
+
+	// Stop removes a started container
+	Stop(ctx context.Context, id string) error
+
+	// Running reports whether a started container is still running
+	Running(ctx context.Context, id string) bool
+}
+
+// Describer is implemented by runtimes that can show what a run would do
+// without doing it
+type Describer interface {
+	// Describe returns the command line Run would execute for opts, with
+	// image standing in for the loaded image
+	Describe(opts RunOptions, image string) []string
+}
+
 // RunOptions configures how to run the container
 type RunOptions struct {
 	// Path to the OCI image tarball
 	ImagePath string
 
-	// Script to execute (will be mounted read-only)
+	// Script to execute (will be mounted read-only at ScriptMountPath)
 	ScriptPath string
 
+	// Path used to invoke the script inside the container, which becomes
+	// its $0 (defaults to ScriptMountPath)
+	ScriptName string
+
+	// Command that runs the script, e.g. ["/bin/sh"] (optional, the script
+	// is executed directly when empty)
+	Interpreter []string
+
 	// Arguments to pass to the script
 	ScriptArgs []string
 
-	// Working directory to bind mount
+	// Command to run instead of the script or the image's own command
+	// (optional)
+	Command []string
+
+	// Working directory to bind mount at WorkspacePath
 	WorkDir string
 
+	// Working directory inside the container (defaults to WorkspacePath)
+	ContainerWorkDir string
+
+	// Additional host paths to bind mount
+	Mounts []Mount
+
+	// Container ports to publish on the host
+	Ports []PortMapping
+
+	// Secrets to expose under SecretsDir
+	Secrets []Secret
+
+	// Host directory to copy OutputPath into after the container exits
+	OutputDir string
+
+	// Restrictions for running untrusted code
+	Sandbox Sandbox
+
 	// Interactive mode (attach stdin/stdout/stderr)
 	Interactive bool
 
+	// Run an init process as PID 1 so signals reach the shell
+	Init bool
+
+	// Environment variables
+	Env map[string]string
+
+	// Stdin/stdout/stderr (optional, defaults to os.Std*)
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// MountType identifies what a mount provides to the container
+type MountType int
+
+const (
+	// MountBind bind mounts a host file or directory
+	MountBind MountType = iota
+
+	// MountSSHAgent forwards the host SSH agent socket and points SSH_AUTH_SOCK at it
+	MountSSHAgent
+
+	// MountGitConfig forwards a git config file and makes it git's global config
+	MountGitConfig
+)
+
+// ScriptMountDir is the container directory RunOptions.ScriptPath is
+// mounted in
+const ScriptMountDir = "/apko-shell/script"
+
+// ScriptMountPath returns where the script at scriptPath is mounted in the
+// container. It keeps the script's file name, which interpreters such as
+// go run look at.
+func ScriptMountPath(scriptPath string) string {
+	return path.Join(ScriptMountDir, filepath.Base(scriptPath))
+}
+
+// WorkspacePath is where RunOptions.WorkDir is mounted in the container
+const WorkspacePath = "/workspace"
+
+// OutputPath is the container directory whose contents are copied to
+// RunOptions.OutputDir after the container exits
+const OutputPath = "/apko-shell/out"
+
+// Container paths for forwarded credentials. Known hosts are mounted as
+// the system-wide known_hosts file, which ssh reads in addition to the
+// user's own, so no ssh or git settings need to be overridden.
+const (
+	SSHAgentSocketPath = "/run/apko-shell/ssh-agent.sock"
+	GitConfigPath      = "/run/apko-shell/gitconfig"
+	KnownHostsPath     = "/etc/ssh/ssh_known_hosts"
+)
+
+// Sandbox restricts what a container can do to its host. The zero value
+// applies no restrictions.
+type Sandbox struct {
+	// Mount the working directory read-only
+	ReadOnlyWorkDir bool
+
+	// Mount the root filesystem read-only, with a writable tmpfs at /tmp
+	// and at each of TmpfsDirs
+	ReadOnlyRootFS bool
+
+	// Directories kept writable over a read-only root filesystem, such as
+	// the home directory, owned by the user the container runs as
+	TmpfsDirs []string
+
+	// Drop all Linux capabilities
+	DropCapabilities bool
+
+	// Prevent processes from gaining privileges through setuid binaries or file capabilities
+	NoNewPrivileges bool
+
+	// Disable networking
+	DisableNetwork bool
+}
+
+// Mount exposes a host path inside the container
+type Mount struct {
+	// Kind of mount (defaults to MountBind)
+	Type MountType
+
+	// Host path
+	Source string
+
+	// Path inside the container
+	Target string
+
+	// Mount read-only
+	ReadOnly bool
+}
+
+// ExecOptions configures a command run inside a started container
+type ExecOptions struct {
+	// Command and arguments to execute
+	Command []string
+
+	// Interactive mode (allocate a TTY)
+	Interactive bool
+
 	// Environment variables
 	Env map[string]string
 
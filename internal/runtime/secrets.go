@@ -0,0 +1,88 @@
+package runtime
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// SecretsDir is the directory secrets are exposed under inside the container
+const SecretsDir = "/run/secrets"
+
+// validSecretID matches IDs that are safe to use as file names
+var validSecretID = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Secret is exposed to the container as a file under SecretsDir. Secrets
+// are never baked into the image or passed as environment variables;
+// runtimes are responsible for mounting them without persisting their
+// contents.
+type Secret struct {
+	// Name of the file under SecretsDir
+	ID string
+
+	// Host file containing the secret (mutually exclusive with Env)
+	Source string
+
+	// Host environment variable containing the secret (mutually exclusive with Source)
+	Env string
+}
+
+// ParseSecret parses a secret of the form id=NAME[,src=PATH|,env=VAR].
+// When neither src nor env is given, the secret is read from the
+// environment variable named after the ID.
+func ParseSecret(s string) (Secret, error) {
+	var secret Secret
+
+	for _, field := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return Secret{}, fmt.Errorf("invalid secret %q: expected key=value, got %q", s, field)
+		}
+
+		switch key {
+		case "id":
+			secret.ID = value
+		case "src", "source":
+			secret.Source = value
+		case "env":
+			secret.Env = value
+		default:
+			return Secret{}, fmt.Errorf("invalid secret %q: unknown key %q", s, key)
+		}
+	}
+
+	if !validSecretID.MatchString(secret.ID) {
+		return Secret{}, fmt.Errorf("invalid secret %q: id must match %s", s, validSecretID)
+	}
+	if secret.Source != "" && secret.Env != "" {
+		return Secret{}, fmt.Errorf("invalid secret %q: src and env are mutually exclusive", s)
+	}
+	if secret.Source == "" && secret.Env == "" {
+		secret.Env = secret.ID
+	}
+
+	return secret, nil
+}
+
+// Target returns the path of the secret inside the container
+func (s Secret) Target() string {
+	return SecretsDir + "/" + s.ID
+}
+
+// Value reads the secret from its source file or environment variable
+func (s Secret) Value() ([]byte, error) {
+	if s.Source != "" {
+		value, err := os.ReadFile(s.Source)
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %w", s.ID, err)
+		}
+		return value, nil
+	}
+
+	value, ok := os.LookupEnv(s.Env)
+	if !ok {
+		return nil, fmt.Errorf("secret %s: environment variable %s is not set", s.ID, s.Env)
+	}
+	return []byte(value), nil
+}
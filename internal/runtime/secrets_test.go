@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    Secret
+		wantErr bool
+	}{
+		{
+			name: "file",
+			spec: "id=npmrc,src=/home/me/.npmrc",
+			want: Secret{ID: "npmrc", Source: "/home/me/.npmrc"},
+		},
+		{
+			name: "source alias",
+			spec: "id=npmrc,source=.npmrc",
+			want: Secret{ID: "npmrc", Source: ".npmrc"},
+		},
+		{
+			name: "env",
+			spec: "id=token,env=GITHUB_TOKEN",
+			want: Secret{ID: "token", Env: "GITHUB_TOKEN"},
+		},
+		{
+			name: "defaults to env named after id",
+			spec: "id=GITHUB_TOKEN",
+			want: Secret{ID: "GITHUB_TOKEN", Env: "GITHUB_TOKEN"},
+		},
+		{
+			name:    "missing id",
+			spec:    "env=TOKEN",
+			wantErr: true,
+		},
+		{
+			name:    "path traversal in id",
+			spec:    "id=../token,env=TOKEN",
+			wantErr: true,
+		},
+		{
+			name:    "both src and env",
+			spec:    "id=token,src=f,env=TOKEN",
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			spec:    "id=token,mode=0400",
+			wantErr: true,
+		},
+		{
+			name:    "not key value",
+			spec:    "token",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSecret(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSecret(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSecret(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretValue(t *testing.T) {
+	t.Setenv("APKO_SHELL_TEST_SECRET", "s3cr3t")
+
+	got, err := Secret{ID: "x", Env: "APKO_SHELL_TEST_SECRET"}.Value()
+	if err != nil {
+		t.Fatalf("Value() error = %v", err)
+	}
+	if string(got) != "s3cr3t" {
+		t.Errorf("Value() = %q, want %q", got, "s3cr3t")
+	}
+
+	if _, err := (Secret{ID: "x", Env: "APKO_SHELL_TEST_UNSET"}).Value(); err == nil {
+		t.Error("Value() of unset variable succeeded, want error")
+	}
+
+	src := filepath.Join(t.TempDir(), "npmrc")
+	if err := os.WriteFile(src, []byte("registry"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err = Secret{ID: "npmrc", Source: src}.Value()
+	if err != nil || string(got) != "registry" {
+		t.Errorf("Value() of file = %q, %v; want %q", got, err, "registry")
+	}
+
+	if _, err := (Secret{ID: "x", Source: src + ".missing"}).Value(); err == nil {
+		t.Error("Value() of missing file succeeded, want error")
+	}
+}
@@ -0,0 +1,89 @@
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/script"
+)
+
+// Kinds of scripts that can be scaffolded
+const (
+	Bash   = "bash"
+	Python = "python"
+)
+
+//go:embed templates
+var templates embed.FS
+
+// scriptTemplates maps script kinds to their template files
+var scriptTemplates = map[string]string{
+	Bash:   "templates/bash.sh",
+	Python: "templates/python.py",
+}
+
+// Kinds returns the kinds of scripts that can be scaffolded
+func Kinds() []string {
+	kinds := make([]string, 0, len(scriptTemplates))
+	for kind := range scriptTemplates {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+// kindExtensions maps file extensions to the kinds of scripts
+// conventionally stored under them
+var kindExtensions = map[string]string{
+	"":      Bash,
+	".sh":   Bash,
+	".bash": Bash,
+	".py":   Python,
+}
+
+// KindOf returns the kind of script conventionally stored at path, by its
+// extension. Scripts without an extension are Bash.
+func KindOf(path string) (string, error) {
+	ext := filepath.Ext(path)
+	kind, ok := kindExtensions[strings.ToLower(ext)]
+	if !ok {
+		return "", fmt.Errorf("no script kind for extension %q, expected none, .sh, .bash or .py", ext)
+	}
+	return kind, nil
+}
+
+// Script returns a new script of the given kind. The template is checked
+// with the script parser, so it always parses as apko-shell reads scripts.
+func Script(kind string) ([]byte, error) {
+	name, ok := scriptTemplates[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown script kind %q, expected one of %s", kind, strings.Join(Kinds(), ", "))
+	}
+
+	data, err := templates.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := script.Parse(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", kind, err)
+	}
+	return data, nil
+}
+
+// Project returns a new project configuration file, checked with the
+// configuration parser
+func Project() ([]byte, error) {
+	data, err := templates.ReadFile("templates/" + config.ProjectFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := config.Parse(bytes.NewReader(data), config.SourceProject); err != nil {
+		return nil, fmt.Errorf("invalid project template: %w", err)
+	}
+	return data, nil
+}
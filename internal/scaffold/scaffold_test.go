@@ -0,0 +1,98 @@
+package scaffold
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/joshrwolf/apko-shell/internal/config"
+	"github.com/joshrwolf/apko-shell/internal/script"
+)
+
+func TestScript(t *testing.T) {
+	tests := []struct {
+		kind            string
+		wantPackages    []string
+		wantInterpreter []string
+		wantPython      bool
+	}{
+		{kind: Bash, wantPackages: []string{"ca-certificates-bundle"}},
+		{kind: Python, wantInterpreter: []string{"uv", "run", "--script"}, wantPython: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			data, err := Script(tt.kind)
+			if err != nil {
+				t.Fatalf("Script() error = %v", err)
+			}
+			if !bytes.HasPrefix(data, []byte("#!/usr/bin/env apko-shell\n#!apko-shell ")) {
+				t.Errorf("Script() doesn't start with the apko-shell shebang lines:\n%s", data)
+			}
+
+			cfg, err := script.Parse(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !slices.Contains(cfg.ShebangTokens, script.Token{Value: "-p", Line: 2}) {
+				t.Errorf("ShebangTokens = %v, want a -p argument", cfg.ShebangTokens)
+			}
+			if cfg.ImageConfig == nil {
+				t.Fatal("ImageConfig = nil, want an apko block")
+			}
+			if got := cfg.ImageConfig.Contents.Packages; strings.Join(got, " ") != strings.Join(tt.wantPackages, " ") {
+				t.Errorf("Packages = %v, want %v", got, tt.wantPackages)
+			}
+			if (cfg.Python != nil) != tt.wantPython {
+				t.Errorf("Python = %v, want present %v", cfg.Python, tt.wantPython)
+			}
+			if got := cfg.Interpreter("script"); strings.Join(got, " ") != strings.Join(tt.wantInterpreter, " ") {
+				t.Errorf("Interpreter() = %v, want %v", got, tt.wantInterpreter)
+			}
+		})
+	}
+
+	if _, err := Script("cobol"); err == nil {
+		t.Error("Script(cobol) error = nil, want error")
+	}
+}
+
+func TestProject(t *testing.T) {
+	data, err := Project()
+	if err != nil {
+		t.Fatalf("Project() error = %v", err)
+	}
+
+	l, err := config.Parse(bytes.NewReader(data), config.SourceProject)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if strings.Join(l.Packages, " ") != "busybox" {
+		t.Errorf("Packages = %v, want [busybox]", l.Packages)
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	for path, want := range map[string]string{
+		"hello.py":       Python,
+		"HELLO.PY":       Python,
+		"hello.sh":       Bash,
+		"hello.bash":     Bash,
+		"hello":          Bash,
+		"scripts/hello":  Bash,
+		"hello.v2/build": Bash,
+	} {
+		got, err := KindOf(path)
+		if err != nil || got != want {
+			t.Errorf("KindOf(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+
+	// Other extensions aren't silently given the bash template
+	for _, path := range []string{"hello.js", "hello.rb", "hello.zsh", "hello.txt"} {
+		if got, err := KindOf(path); err == nil {
+			t.Errorf("KindOf(%q) = %q, want error", path, got)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+#!/usr/bin/env apko-shell
+#!apko-shell --shell=/bin/bash -p curl,jq
+# /// apko
+# # Image configuration in apko's format, plus apko-shell's ports, caches
+# # and artifacts. Uncomment what the script needs.
+# contents:
+#   packages:
+#     - ca-certificates-bundle
+# # environment:
+# #   TZ: UTC
+# # ports:
+# #   - 8080:8080
+# # caches:
+# #   - go
+# # artifacts: out
+# ///
+
+set -euo pipefail
+
+echo "Hello from $(uname -sr)!"
+jq -n --arg shell "$BASH_VERSION" '{shell: "bash", version: $shell}'
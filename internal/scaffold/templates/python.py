@@ -0,0 +1,26 @@
+#!/usr/bin/env apko-shell
+#!apko-shell -p ca-certificates-bundle
+# /// script
+# requires-python = ">=3.12"
+# dependencies = [
+#   "rich",
+# ]
+# ///
+# /// apko
+# # Image configuration in apko's format, plus apko-shell's ports, caches
+# # and artifacts. Uncomment what the script needs.
+# environment:
+#   PYTHONUNBUFFERED: "1"
+# # contents:
+# #   packages:
+# #     - git
+# # ports:
+# #   - 8000:8000
+# # artifacts: out
+# ///
+
+import platform
+
+from rich import print
+
+print(f"[bold]Hello from Python {platform.python_version()}![/bold]")
@@ -0,0 +1,513 @@
+package script
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Command is an external command a shell script invokes
+type Command struct {
+	Name string
+
+	// Line of the first invocation, starting at 1
+	Line int
+}
+
+// shellBuiltins are commands the shell itself provides
+var shellBuiltins = []string{
+	".", ":", "[", "alias", "bg", "break", "builtin", "caller", "cd", "command",
+	"compgen", "complete", "continue", "declare", "dirs", "disown", "echo",
+	"enable", "eval", "exec", "exit", "export", "false", "fc", "fg", "getopts",
+	"hash", "help", "jobs", "kill", "let", "local", "logout", "mapfile", "popd",
+	"printf", "pushd", "pwd", "read", "readarray", "readonly", "return", "set",
+	"shift", "shopt", "source", "test", "time", "times", "trap", "true", "type",
+	"typeset", "ulimit", "umask", "unalias", "unset", "wait",
+}
+
+// commandWrappers run the command given as their first operand
+var commandWrappers = []string{"command", "env", "exec", "nice", "nohup", "sudo", "time", "xargs"}
+
+// wrapperValueOptions are the options of command wrappers whose value is
+// the next word, which is then not the wrapped command
+var wrapperValueOptions = map[string][]string{
+	"env":   {"-u", "--unset", "-C", "--chdir"},
+	"exec":  {"-a"},
+	"nice":  {"-n", "--adjustment"},
+	"sudo":  {"-u", "--user", "-g", "--group", "-C", "--close-from", "-D", "--chdir", "-h", "--host", "-p", "--prompt", "-R", "--chroot", "-r", "--role", "-t", "--type", "-T", "--command-timeout", "-U", "--other-user"},
+	"xargs": {"-I", "-n", "--max-args", "-P", "--max-procs", "-L", "--max-lines", "-s", "--max-chars", "-a", "--arg-file", "-d", "--delimiter", "-E"},
+}
+
+// shellKeywords are reserved words after which a command may follow
+var shellKeywords = []string{"!", "{", "do", "elif", "else", "if", "then", "until", "while"}
+
+// shellClosers are reserved words ending a compound command
+var shellClosers = []string{"}", "done", "esac", "fi"}
+
+// assignment matches a variable assignment prefix such as FOO=bar
+var assignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\[[^]]*\])?\+?=`)
+
+// Commands statically scans a shell script for the external commands it
+// invokes, in order of first use. Builtins, functions defined by the
+// script, relative paths and commands whose name is only known at run
+// time are left out. The scan is best effort: it recognizes common
+// constructs, not the whole shell grammar.
+func Commands(src string) []Command {
+	s := &shScanner{src: src, line: 1}
+	streams := [][]shToken{s.scan(0)}
+	streams = append(streams, s.nested...)
+
+	c := &commandCollector{functions: map[string]bool{}}
+	for _, tokens := range streams {
+		c.collect(tokens)
+	}
+
+	// Substitutions were collected after the commands around them
+	slices.SortStableFunc(c.commands, func(a, b Command) int { return a.Line - b.Line })
+
+	var cmds []Command
+	seen := map[string]bool{}
+	for _, cmd := range c.commands {
+		if seen[cmd.Name] || c.functions[cmd.Name] {
+			continue
+		}
+		seen[cmd.Name] = true
+		cmds = append(cmds, cmd)
+	}
+	return cmds
+}
+
+// shToken is a word or operator of a shell script
+type shToken struct {
+	val  string
+	op   bool
+	line int
+
+	// The word contains expansions, so its value is unknown
+	dynamic bool
+}
+
+// shScanner splits a script into tokens. Command substitutions are
+// scanned into separate token streams.
+type shScanner struct {
+	src  string
+	pos  int
+	line int
+
+	nested   [][]shToken
+	heredocs []heredoc
+}
+
+// heredoc is a here-document whose body starts on the next line
+type heredoc struct {
+	delim string
+	strip bool
+}
+
+// scan returns the tokens up to stop, or the end of the script when stop
+// is 0
+func (s *shScanner) scan(stop byte) []shToken {
+	var (
+		tokens  []shToken
+		word    strings.Builder
+		inWord  bool
+		dynamic bool
+		depth   int
+	)
+
+	flush := func() {
+		if !inWord {
+			return
+		}
+		tok := shToken{val: word.String(), line: s.line, dynamic: dynamic}
+		if n := len(tokens); n > 0 && tokens[n-1].op && strings.HasPrefix(tokens[n-1].val, "<<") && tokens[n-1].val != "<<<" {
+			s.heredocs = append(s.heredocs, heredoc{delim: tok.val, strip: tokens[n-1].val == "<<-"})
+		}
+		tokens = append(tokens, tok)
+		word.Reset()
+		inWord, dynamic = false, false
+	}
+	op := func(val string) {
+		flush()
+		tokens = append(tokens, shToken{val: val, op: true, line: s.line})
+	}
+
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+
+		if stop != 0 && c == stop && depth == 0 {
+			s.pos++
+			flush()
+			return tokens
+		}
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			flush()
+			s.pos++
+
+		case c == '\\':
+			if s.pos+1 < len(s.src) && s.src[s.pos+1] == '\n' {
+				s.line++
+			} else if s.pos+1 < len(s.src) {
+				word.WriteByte(s.src[s.pos+1])
+				inWord = true
+			}
+			s.pos += 2
+
+		case c == '\n':
+			op("\n")
+			s.pos++
+			s.line++
+			s.skipHeredocs()
+
+		case c == '#' && !inWord:
+			for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+				s.pos++
+			}
+
+		case c == '\'':
+			s.pos++
+			word.WriteString(s.until('\''))
+			inWord = true
+
+		case c == '"':
+			s.pos++
+			if s.doubleQuoted(&word) {
+				dynamic = true
+			}
+			inWord = true
+
+		case c == '`':
+			s.pos++
+			s.nested = append(s.nested, s.scan('`'))
+			inWord, dynamic = true, true
+
+		case c == '$':
+			s.dollar(&word)
+			inWord, dynamic = true, true
+
+		case c == '(' && s.peek(1) == '(' && !inWord:
+			// Arithmetic, as in (( i++ )) or for ((...))
+			s.pos += 2
+			s.skipArithmetic()
+
+		case c == '(' && inWord && strings.HasSuffix(word.String(), "="):
+			// Array assignment, as in arr=(a b c)
+			s.pos++
+			word.WriteString("(" + s.until(')') + ")")
+
+		case c == '(' || c == ')':
+			if stop == ')' {
+				if c == '(' {
+					depth++
+				} else {
+					depth--
+				}
+			}
+			op(string(c))
+			s.pos++
+
+		case c == '<' || c == '>':
+			// A file descriptor number belongs to the redirection
+			if inWord && !dynamic && strings.Trim(word.String(), "0123456789") == "" {
+				word.Reset()
+				inWord = false
+			}
+			if s.peek(1) == '(' {
+				// Process substitution
+				s.pos += 2
+				s.nested = append(s.nested, s.scan(')'))
+				inWord, dynamic = true, true
+				continue
+			}
+			op(s.operator("<<<", "<<-", "<<", "<&", "<>", ">>", ">&", ">|", "<", ">"))
+
+		case c == '|' || c == '&' || c == ';':
+			if c == '&' && s.peek(1) == '>' {
+				op(s.operator("&>>", "&>"))
+				continue
+			}
+			op(s.operator("||", "|&", "&&", ";;&", ";;", ";&", "|", "&", ";"))
+
+		default:
+			word.WriteByte(c)
+			inWord = true
+			s.pos++
+		}
+	}
+
+	flush()
+	return tokens
+}
+
+// peek returns the byte n positions ahead, or 0 past the end
+func (s *shScanner) peek(n int) byte {
+	if s.pos+n < len(s.src) {
+		return s.src[s.pos+n]
+	}
+	return 0
+}
+
+// operator consumes the first of ops found at the current position
+func (s *shScanner) operator(ops ...string) string {
+	for _, op := range ops {
+		if strings.HasPrefix(s.src[s.pos:], op) {
+			s.pos += len(op)
+			return op
+		}
+	}
+	s.pos++
+	return s.src[s.pos-1 : s.pos]
+}
+
+// until consumes text up to and including end, returning the text before it
+func (s *shScanner) until(end byte) string {
+	start := s.pos
+	for s.pos < len(s.src) && s.src[s.pos] != end {
+		if s.src[s.pos] == '\n' {
+			s.line++
+		}
+		s.pos++
+	}
+	text := s.src[start:s.pos]
+	s.pos++
+	return text
+}
+
+// doubleQuoted consumes a double-quoted string after its opening quote,
+// reporting whether it contains expansions
+func (s *shScanner) doubleQuoted(word *strings.Builder) bool {
+	dynamic := false
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch c {
+		case '"':
+			s.pos++
+			return dynamic
+		case '\\':
+			if s.pos+1 < len(s.src) {
+				word.WriteByte(s.src[s.pos+1])
+			}
+			s.pos += 2
+		case '$':
+			s.dollar(word)
+			dynamic = true
+		case '`':
+			s.pos++
+			s.nested = append(s.nested, s.scan('`'))
+			dynamic = true
+		default:
+			if c == '\n' {
+				s.line++
+			}
+			word.WriteByte(c)
+			s.pos++
+		}
+	}
+	return dynamic
+}
+
+// dollar consumes an expansion starting with $
+func (s *shScanner) dollar(word *strings.Builder) {
+	word.WriteByte('$')
+	s.pos++
+	switch s.peek(0) {
+	case '(':
+		if s.peek(1) == '(' {
+			s.pos += 2
+			s.skipArithmetic()
+			return
+		}
+		s.pos++
+		s.nested = append(s.nested, s.scan(')'))
+	case '{':
+		s.pos++
+		s.until('}')
+	case '\'':
+		// ANSI-C quoting, as in $'a\tb'
+		s.pos++
+		for s.pos < len(s.src) && s.src[s.pos] != '\'' {
+			if s.src[s.pos] == '\\' {
+				s.pos++
+			}
+			s.pos++
+		}
+		s.pos++
+	}
+}
+
+// skipArithmetic consumes an arithmetic expression up to its closing "))"
+func (s *shScanner) skipArithmetic() {
+	depth := 0
+	for s.pos < len(s.src) {
+		switch s.src[s.pos] {
+		case '$':
+			if s.peek(1) == '(' && s.peek(2) != '(' {
+				s.pos += 2
+				s.nested = append(s.nested, s.scan(')'))
+				continue
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 && s.peek(1) == ')' {
+				s.pos += 2
+				return
+			}
+			depth--
+		case '\n':
+			s.line++
+		}
+		s.pos++
+	}
+}
+
+// skipHeredocs consumes the bodies of pending here-documents
+func (s *shScanner) skipHeredocs() {
+	for _, h := range s.heredocs {
+		for s.pos < len(s.src) {
+			end := strings.IndexByte(s.src[s.pos:], '\n')
+			if end < 0 {
+				end = len(s.src) - s.pos
+			}
+			line := s.src[s.pos : s.pos+end]
+			s.pos += end + 1
+			s.line++
+			if h.strip {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == h.delim {
+				break
+			}
+		}
+	}
+	s.heredocs = nil
+}
+
+// commandCollector finds the words of token streams in command position
+type commandCollector struct {
+	commands  []Command
+	functions map[string]bool
+}
+
+// collect records the commands invoked by a token stream
+func (c *commandCollector) collect(tokens []shToken) {
+	var (
+		cmdPos      = true
+		wrapped     string // wrapper whose operand is pending
+		skipTarget  bool   // the next word is a redirection target, function name or option value
+		skipUntil   string // keyword ending a skipped clause
+		casePattern bool   // in the patterns of a case clause
+	)
+
+	for i, tok := range tokens {
+		if skipUntil != "" {
+			if !tok.op && tok.val == skipUntil {
+				if skipUntil == "in" {
+					casePattern = true
+				}
+				skipUntil = ""
+				cmdPos = true
+			}
+			continue
+		}
+
+		if tok.op {
+			switch {
+			case strings.ContainsAny(tok.val, "<>"):
+				skipTarget = true
+			case tok.val == ")" && casePattern:
+				casePattern = false
+				cmdPos = true
+			case tok.val == ";;" || tok.val == ";&" || tok.val == ";;&":
+				casePattern = true
+			default:
+				cmdPos = true
+				wrapped = ""
+			}
+			continue
+		}
+
+		if skipTarget {
+			skipTarget = false
+			continue
+		}
+		if casePattern {
+			if tok.val == "esac" {
+				casePattern = false
+				cmdPos = false
+			}
+			continue
+		}
+		if !cmdPos {
+			continue
+		}
+
+		name := tok.val
+		if wrapped != "" {
+			switch {
+			case wrapped == "command" && (name == "-v" || name == "-V"):
+				cmdPos = false
+				continue
+			case slices.Contains(wrapperValueOptions[wrapped], name):
+				skipTarget = true
+				continue
+			case strings.HasPrefix(name, "-"), assignment.MatchString(name), strings.Trim(name, "0123456789") == "":
+				continue
+			}
+			wrapped = ""
+		}
+
+		switch {
+		case slices.Contains(shellKeywords, name):
+			continue
+		case slices.Contains(shellClosers, name):
+			cmdPos = false
+			continue
+		case name == "for" || name == "select":
+			skipUntil = "do"
+			continue
+		case name == "case":
+			skipUntil = "in"
+			continue
+		case name == "[[":
+			skipUntil = "]]"
+			continue
+		case name == "function":
+			if i+1 < len(tokens) && !tokens[i+1].op {
+				c.functions[tokens[i+1].val] = true
+			}
+			skipTarget = true
+			continue
+		case i+2 < len(tokens) && tokens[i+1].op && tokens[i+1].val == "(" && tokens[i+2].op && tokens[i+2].val == ")":
+			// Function definition, as in name() { ...; }
+			c.functions[name] = true
+			cmdPos = false
+			continue
+		case assignment.MatchString(name):
+			continue
+		}
+
+		cmdPos = false
+		if tok.dynamic {
+			continue
+		}
+		if strings.Contains(name, "/") {
+			if !strings.HasPrefix(name, "/") {
+				continue
+			}
+			name = path.Base(name)
+		}
+
+		if slices.Contains(commandWrappers, name) {
+			wrapped = name
+			cmdPos = true
+		}
+		if name == "" || slices.Contains(shellBuiltins, name) {
+			continue
+		}
+		c.commands = append(c.commands, Command{Name: name, Line: tok.line})
+	}
+}
@@ -0,0 +1,119 @@
+package script
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "pipeline",
+			script: "#!/usr/bin/env apko-shell\ncurl -fsSL https://example.com | jq .name\n",
+			want:   []string{"curl:2", "jq:2"},
+		},
+		{
+			name:   "lists and builtins",
+			script: "set -e\ncd /tmp && git clone repo || echo failed; make -j4 &\nwait\n",
+			want:   []string{"git:2", "make:2"},
+		},
+		{
+			name:   "first use only",
+			script: "jq . a\njq . b\n",
+			want:   []string{"jq:1"},
+		},
+		{
+			name:   "assignments and redirections",
+			script: "FOO=bar LANG=C sort -u <in.txt 2>/dev/null >out.txt\nexec 3>&1\n",
+			want:   []string{"sort:1"},
+		},
+		{
+			name: "compound commands",
+			script: `if [ -f go.mod ]; then
+	go build ./...
+elif command -v cargo; then
+	cargo build
+fi
+for f in *.yaml; do yq . "$f"; done
+while read -r line; do
+	grep -q x <<< "$line" && break
+done < list
+case "$1" in
+	build|b) make ;;
+	(test) go test ./... ;;
+	*) usage ;;
+esac
+[[ -n $x && $y < 3 ]] && tar -xf a.tar
+(( count++ ))
+{ rsync a b; } | tee log
+`,
+			want: []string{"go:2", "cargo:4", "yq:6", "grep:8", "make:11", "usage:13", "tar:15", "rsync:17", "tee:17"},
+		},
+		{
+			name:   "substitutions",
+			script: "version=$(git describe --tags)\necho \"built $(date -u) by `whoami`\"\ndiff <(sort a) b\nn=$((1 + $(wc -l < f)))\n",
+			want:   []string{"git:1", "date:2", "whoami:2", "diff:3", "sort:3", "wc:4"},
+		},
+		{
+			name:   "wrappers",
+			script: "sudo -E apk update\nenv -i PATH=/bin python3 x.py\nfind . -name '*.go' | xargs -n1 gofmt -l\ncommand -v docker\ntime nice -n 10 ffmpeg -i in\n",
+			want:   []string{"sudo:1", "apk:1", "env:2", "python3:2", "find:3", "xargs:3", "gofmt:3", "nice:5", "ffmpeg:5"},
+		},
+		{
+			name:   "wrapper option values",
+			script: "sudo -u root apt-get install\nls | xargs -I {} cp {} /tmp\nenv -u HOME -C /src make\nnice -n -5 sudo --user=me -g wheel id\nxargs -P 4 -n 1 curl -O\nexec -a name node app.js\n",
+			want:   []string{"sudo:1", "apt-get:1", "ls:2", "xargs:2", "cp:2", "env:3", "make:3", "nice:4", "id:4", "curl:5", "node:6"},
+		},
+		{
+			name: "functions",
+			script: `log() { printf '%s\n' "$*" >&2; }
+function deploy {
+	kubectl apply -f .
+}
+log start
+deploy
+`,
+			want: []string{"kubectl:3"},
+		},
+		{
+			name: "heredocs and comments",
+			script: `cat <<EOF
+not-a-command here
+EOF
+psql <<-'SQL'
+	select 1;
+	SQL
+# curl in a comment
+echo "# not a comment" # jq
+`,
+			want: []string{"cat:1", "psql:4"},
+		},
+		{
+			name:   "paths and dynamic names",
+			script: "/usr/bin/env bash -c x\n./build.sh\n$CC -o a a.c\n\"$tool\" run\narr=(a b c)\n",
+			want:   []string{"env:1", "bash:1"},
+		},
+		{
+			name:   "line continuations",
+			script: "docker run \\\n  --rm alpine \\\n  true\nhelm version\n",
+			want:   []string{"docker:1", "helm:4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, cmd := range Commands(tt.script) {
+				got = append(got, fmt.Sprintf("%s:%d", cmd.Name, cmd.Line))
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Commands() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
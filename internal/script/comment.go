@@ -0,0 +1,54 @@
+package script
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// commentPrefixes are the line comment syntaxes metadata may be written
+// in, in the order they are tried when detecting one
+var commentPrefixes = []string{"#", "//", "--", ";"}
+
+// extensionComments maps file extensions to their line comment syntax
+var extensionComments = map[string]string{
+	".sh":    "#",
+	".bash":  "#",
+	".py":    "#",
+	".rb":    "#",
+	".pl":    "#",
+	".go":    "//",
+	".js":    "//",
+	".mjs":   "//",
+	".cjs":   "//",
+	".ts":    "//",
+	".rs":    "//",
+	".c":     "//",
+	".java":  "//",
+	".kt":    "//",
+	".swift": "//",
+	".lua":   "--",
+	".sql":   "--",
+	".hs":    "--",
+	".clj":   ";",
+	".el":    ";",
+	".lisp":  ";",
+	".scm":   ";",
+	".ini":   ";",
+}
+
+// CommentPrefix returns the line comment syntax conventional for the file
+// extension of scriptPath, or "" when it is not known
+func CommentPrefix(scriptPath string) string {
+	return extensionComments[strings.ToLower(filepath.Ext(scriptPath))]
+}
+
+// detectComment returns the comment syntax line starts with, or "" when
+// the line is not a comment
+func detectComment(line string) string {
+	for _, prefix := range commentPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package script
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCommentSyntaxes(t *testing.T) {
+	tests := []struct {
+		name         string
+		file         string
+		script       string
+		wantArgs     []string
+		wantPackages []string
+	}{
+		{
+			name: "go by extension",
+			file: "main.go",
+			script: `//go:build ignore
+
+//!apko-shell --workdir=script
+// /// apko
+// contents:
+//   packages: [go]
+// ///
+package main`,
+			wantArgs:     []string{"--workdir=script"},
+			wantPackages: []string{"go"},
+		},
+		{
+			name: "javascript after interpreter line",
+			file: "tool.mjs",
+			script: `#!/usr/bin/env apko-shell
+//!apko-shell -p jq
+// /// apko
+// contents:
+//   packages: [nodejs]
+// ///
+console.log("hi")`,
+			wantArgs:     []string{"-p jq"},
+			wantPackages: []string{"nodejs"},
+		},
+		{
+			name: "sql by extension",
+			file: "report.sql",
+			script: `-- /// apko
+-- contents:
+--   packages: [postgresql-client]
+-- cmd: psql -f
+-- ///
+SELECT 1;`,
+			wantPackages: []string{"postgresql-client"},
+		},
+		{
+			name: "detected from the first line",
+			file: "query",
+			script: `; /// apko
+; contents:
+;   packages: [sqlite]
+; ///`,
+			wantPackages: []string{"sqlite"},
+		},
+		{
+			name: "hash lines are not comments in go",
+			file: "main.go",
+			script: `#!apko-shell -p curl
+package main`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.script), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := ParseFile(path)
+			if err != nil {
+				t.Fatalf("ParseFile() error = %v", err)
+			}
+
+			if got := strings.Join(cfg.ShebangArgs, "|"); got != strings.Join(tt.wantArgs, "|") {
+				t.Errorf("ShebangArgs = %q, want %q", cfg.ShebangArgs, tt.wantArgs)
+			}
+
+			var pkgs []string
+			if cfg.ImageConfig != nil {
+				pkgs = cfg.ImageConfig.Contents.Packages
+			}
+			if strings.Join(pkgs, " ") != strings.Join(tt.wantPackages, " ") {
+				t.Errorf("Packages = %v, want %v", pkgs, tt.wantPackages)
+			}
+		})
+	}
+}
@@ -0,0 +1,444 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// valueShorthands are the shorthand flags other than -p that take a value,
+// which like -p's may follow in the same word
+const valueShorthands = "cP"
+
+// PackageName returns the name of a package spec such as "jq=1.7.1-r0"
+func PackageName(spec string) string {
+	if i := strings.IndexAny(spec, "=<>~"); i >= 0 {
+		return spec[:i]
+	}
+	return spec
+}
+
+// EditPackages rewrites the packages a script declares, touching only the
+// lines declaring them so that formatting and comments are preserved.
+// comment is the script's comment syntax, or "" to detect it.
+//
+// Removed packages, matched by name regardless of version constraints, are
+// taken out of every #!apko-shell -p argument and the apko block's
+// packages list. Added packages replace declarations of the same name, or
+// are appended to the first -p argument, then to the apko block's list,
+// and otherwise to a new #!apko-shell -p line.
+func EditPackages(src []byte, comment string, add, remove []string) ([]byte, error) {
+	lines := strings.SplitAfter(string(src), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	for _, name := range remove {
+		found := false
+		for {
+			h, err := scanHeader(lines, comment)
+			if err != nil {
+				return nil, err
+			}
+			edited, ok, err := h.replace(PackageName(name), "")
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			lines, found = edited, true
+		}
+		if !found {
+			return nil, fmt.Errorf("package %q is not declared in the script", PackageName(name))
+		}
+	}
+
+	for _, spec := range add {
+		h, err := scanHeader(lines, comment)
+		if err != nil {
+			return nil, err
+		}
+		edited, ok, err := h.replace(PackageName(spec), spec)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			edited, err = h.append(spec)
+			if err != nil {
+				return nil, err
+			}
+		}
+		lines = edited
+	}
+
+	out := []byte(strings.Join(lines, ""))
+	if _, err := parse(bytes.NewReader(out), comment); err != nil {
+		return nil, fmt.Errorf("edited script is invalid: %w", err)
+	}
+	return out, nil
+}
+
+// header is a script split into lines that keep their line endings, along
+// with where its metadata is
+type header struct {
+	layout
+	lines []string
+}
+
+// scanHeader parses a script split into lines to locate its metadata
+func scanHeader(lines []string, comment string) (*header, error) {
+	cfg, err := parse(strings.NewReader(strings.Join(lines, "")), comment)
+	if err != nil {
+		return nil, err
+	}
+	return &header{layout: cfg.layout, lines: lines}, nil
+}
+
+// packagesArg is a -p or --packages argument of a #!apko-shell line
+type packagesArg struct {
+	// Byte range of the argument in the line, from the flag through the
+	// value
+	start, end int
+
+	// What to write before a new value: the flag and separator as written
+	// when the value is a word of its own, or the flag otherwise
+	prefix string
+
+	// What remains of the argument without the value, such as "-i" of
+	// "-ip jq", or "" when nothing does
+	rest string
+
+	// Unquoted value, and the quote it was written with, if any
+	value string
+	quote byte
+}
+
+// packagesArgs finds the -p and --packages arguments of the #!apko-shell
+// line at index i, splitting it like parse does
+func (h *header) packagesArgs(i int) ([]packagesArg, error) {
+	line := strings.TrimRight(h.lines[i], "\r\n")
+	base := len(h.comment) + len("!apko-shell")
+	words, err := splitWords(line[base:])
+	if err != nil {
+		return nil, &Error{Line: i + 1, Msg: err.Error()}
+	}
+
+	// own makes an argument of a flag word followed by its value word
+	own := func(flag word, rest string, value word) packagesArg {
+		return packagesArg{
+			start:  base + flag.start,
+			end:    base + value.end,
+			prefix: line[base+flag.start : base+value.start],
+			rest:   rest,
+			value:  value.value,
+			quote:  quoteOf(line[base+value.start : base+value.end]),
+		}
+	}
+	// inline makes an argument of a word holding both flag and value
+	inline := func(w word, flag, rest string) packagesArg {
+		return packagesArg{
+			start:  base + w.start,
+			end:    base + w.end,
+			prefix: flag,
+			rest:   rest,
+			value:  strings.TrimPrefix(w.value, flag),
+			quote:  quoteOf(line[base+w.start : base+w.end]),
+		}
+	}
+
+	var args []packagesArg
+	for j := 0; j < len(words); j++ {
+		w := words[j]
+		switch {
+		case w.value == "--":
+			return args, nil
+		case w.value == "--packages":
+			if j+1 < len(words) {
+				args = append(args, own(w, "", words[j+1]))
+				j++
+			}
+		case strings.HasPrefix(w.value, "--packages="):
+			args = append(args, inline(w, "--packages=", ""))
+		case strings.HasPrefix(w.value, "--"):
+			// Other long flags; values given as separate words are skipped
+			// like positional arguments
+		case strings.HasPrefix(w.value, "-"):
+			// Shorthands, possibly combined as in -ip jq
+			for k := 1; k < len(w.value); k++ {
+				c := w.value[k]
+				if c == 'p' {
+					flag, rest := w.value[:k+1], w.value[:k]
+					if rest == "-" {
+						rest = ""
+					}
+					switch {
+					case k+1 < len(w.value):
+						if k == 1 && w.value[k+1] == '=' {
+							flag += "="
+						}
+						args = append(args, inline(w, flag, rest))
+					case j+1 < len(words):
+						args = append(args, own(w, rest, words[j+1]))
+						j++
+					}
+					break
+				}
+				if strings.IndexByte(valueShorthands, c) >= 0 {
+					if k == len(w.value)-1 {
+						j++
+					}
+					break
+				}
+			}
+		}
+	}
+	return args, nil
+}
+
+// quoteOf returns the quote a raw word ends with, if any
+func quoteOf(raw string) byte {
+	if n := len(raw); n > 1 && (raw[n-1] == '\'' || raw[n-1] == '"') {
+		return raw[n-1]
+	}
+	return 0
+}
+
+// quoteWord quotes v for a #!apko-shell line, with q if it isn't 0 or v
+// can't be written bare
+func quoteWord(v string, q byte) string {
+	if q == 0 && v != "" && !strings.ContainsAny(v, " \t'\"\\#") {
+		return v
+	}
+	if q == '\'' && !strings.Contains(v, "'") {
+		return "'" + v + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(v) + `"`
+}
+
+// setValue returns line i with the value of arg replaced
+func (h *header) setValue(i int, arg packagesArg, value string) []string {
+	line := h.lines[i]
+	return h.setLine(i, line[:arg.start]+arg.prefix+quoteWord(value, arg.quote)+line[arg.end:])
+}
+
+// replace replaces the first declaration of the package name with spec,
+// or removes it when spec is empty. It reports whether name was declared.
+func (h *header) replace(name, spec string) ([]string, bool, error) {
+	for _, i := range h.shebangs {
+		args, err := h.packagesArgs(i)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, arg := range args {
+			pkgs := strings.Split(arg.value, ",")
+			j := slices.IndexFunc(pkgs, func(p string) bool { return PackageName(p) == name })
+			if j < 0 {
+				continue
+			}
+
+			if spec != "" {
+				pkgs[j] = spec
+				return h.setValue(i, arg, strings.Join(pkgs, ",")), true, nil
+			}
+			pkgs = slices.Delete(pkgs, j, j+1)
+			if len(pkgs) > 0 {
+				return h.setValue(i, arg, strings.Join(pkgs, ",")), true, nil
+			}
+
+			// Drop the whole argument, and the line once it has no arguments left
+			line := h.lines[i]
+			if arg.rest != "" {
+				line = line[:arg.start] + arg.rest + line[arg.end:]
+			} else {
+				line = strings.TrimRight(line[:arg.start], " \t") + line[arg.end:]
+			}
+			body := strings.TrimPrefix(strings.TrimRight(line, "\r\n"), h.comment)
+			if words, err := splitWords(strings.TrimPrefix(body, "!apko-shell")); err == nil && len(words) == 0 {
+				return slices.Delete(slices.Clone(h.lines), i, i+1), true, nil
+			}
+			return h.setLine(i, line), true, nil
+		}
+	}
+
+	key, seq, err := h.blockPackages()
+	if err != nil || seq == nil || seq.Kind != yaml.SequenceNode {
+		return h.lines, false, err
+	}
+	j := slices.IndexFunc(seq.Content, func(n *yaml.Node) bool { return PackageName(n.Value) == name })
+	if j < 0 {
+		return h.lines, false, nil
+	}
+
+	if seq.Style&yaml.FlowStyle != 0 {
+		pkgs := flowValues(seq)
+		if spec != "" {
+			pkgs[j] = spec
+		} else {
+			pkgs = slices.Delete(pkgs, j, j+1)
+		}
+		lines, err := h.setFlow(seq, pkgs)
+		return lines, true, err
+	}
+
+	item := seq.Content[j]
+	i := h.apko.lineNum[item.Line-1] - 1
+	line := h.lines[i]
+	if spec != "" {
+		start := h.apko.offset[item.Line-1] + item.Column - 1
+		end := start + len(strings.TrimRight(line[start:], "\r\n"))
+		for c := start + 1; c < end; c++ {
+			if line[c] == '#' && (line[c-1] == ' ' || line[c-1] == '\t') {
+				end = c
+				break
+			}
+		}
+
+		// Keep the spacing before a trailing comment
+		end = start + len(strings.TrimRight(line[start:end], " \t"))
+		return h.setLine(i, line[:start]+spec+line[end:]), true, nil
+	}
+	if len(seq.Content) == 1 {
+		// Keep the list valid rather than leaving a dangling key
+		ki := h.apko.lineNum[key.Line-1] - 1
+		lines := slices.Delete(slices.Clone(h.lines), i, i+1)
+		kl := lines[ki]
+		ke := strings.TrimRight(kl, "\r\n")
+		lines[ki] = strings.TrimRight(ke, " ") + " []" + kl[len(ke):]
+		return lines, true, nil
+	}
+	return slices.Delete(slices.Clone(h.lines), i, i+1), true, nil
+}
+
+// append adds spec where the script declares its packages
+func (h *header) append(spec string) ([]string, error) {
+	for _, i := range h.shebangs {
+		args, err := h.packagesArgs(i)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) > 0 {
+			value := spec
+			if args[0].value != "" {
+				value = args[0].value + "," + spec
+			}
+			return h.setValue(i, args[0], value), nil
+		}
+	}
+
+	key, seq, err := h.blockPackages()
+	if err != nil {
+		return nil, err
+	}
+	if seq != nil && seq.Kind == yaml.SequenceNode && (seq.Style&yaml.FlowStyle != 0 || len(seq.Content) == 0) {
+		return h.setFlow(seq, append(flowValues(seq), spec))
+	}
+	if seq != nil && seq.Kind == yaml.SequenceNode {
+		last := seq.Content[len(seq.Content)-1]
+		i := h.apko.lineNum[last.Line-1] - 1
+		line := h.lines[i]
+		start := h.apko.offset[last.Line-1] + last.Column - 1
+		dash := strings.LastIndex(line[:start], "-")
+		return h.insert(i+1, line[:dash]+"- "+spec+lineEnding(line)), nil
+	}
+	if seq != nil && seq.Tag == "!!null" {
+		// "packages:" without a value
+		i := h.apko.lineNum[key.Line-1] - 1
+		line := h.lines[i]
+		start := h.apko.offset[key.Line-1] + key.Column - 1
+		return h.insert(i+1, line[:start]+"  - "+spec+lineEnding(line)), nil
+	}
+
+	// Declare the package on a new line after the interpreter line
+	line := h.comment + "!apko-shell -p " + spec + "\n"
+	if h.interpreter >= 0 {
+		line = h.comment + "!apko-shell -p " + spec + lineEnding(h.lines[h.interpreter])
+	}
+	return h.insert(h.interpreter+1, line), nil
+}
+
+// blockPackages returns the key and value nodes of the apko block's
+// contents.packages, if present
+func (h *header) blockPackages() (*yaml.Node, *yaml.Node, error) {
+	if h.apko == nil {
+		return nil, nil, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(h.apko.String()), &doc); err != nil {
+		return nil, nil, h.apko.yamlError(err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, nil
+	}
+
+	_, contents := mappingValue(doc.Content[0], "contents")
+	if contents == nil {
+		return nil, nil, nil
+	}
+	key, packages := mappingValue(contents, "packages")
+	return key, packages, nil
+}
+
+// mappingValue returns the key and value nodes of key in a mapping node
+func mappingValue(n *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if n.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i], n.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// flowValues returns the values of a sequence node
+func flowValues(seq *yaml.Node) []string {
+	values := make([]string, 0, len(seq.Content))
+	for _, n := range seq.Content {
+		values = append(values, n.Value)
+	}
+	return values
+}
+
+// setFlow rewrites a single-line flow sequence, such as [git, jq]
+func (h *header) setFlow(seq *yaml.Node, values []string) ([]string, error) {
+	i := h.apko.lineNum[seq.Line-1] - 1
+	line := h.lines[i]
+	start := h.apko.offset[seq.Line-1] + seq.Column - 1
+	end := strings.IndexByte(line[start:], ']')
+	if end < 0 {
+		return nil, &Error{Line: i + 1, Msg: "can't edit a packages list spanning several lines"}
+	}
+	return h.setLine(i, line[:start]+"["+strings.Join(values, ", ")+line[start+end:]), nil
+}
+
+// setLine returns the lines with line i replaced
+func (h *header) setLine(i int, line string) []string {
+	lines := slices.Clone(h.lines)
+	lines[i] = line
+	return lines
+}
+
+// insert returns the lines with line inserted at i
+func (h *header) insert(i int, line string) []string {
+	lines := slices.Clone(h.lines)
+	if i > 0 && !strings.HasSuffix(lines[i-1], "\n") {
+		lines[i-1] += lineEnding(line)
+		line = strings.TrimRight(line, "\r\n")
+	}
+	return slices.Insert(lines, i, line)
+}
+
+// lineEnding returns the line ending of line
+func lineEnding(line string) string {
+	if strings.HasSuffix(line, "\r\n") {
+		return "\r\n"
+	}
+	return "\n"
+}
@@ -0,0 +1,134 @@
+package script
+
+import (
+	"testing"
+)
+
+func TestEditPackages(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		comment string
+		add     []string
+		remove  []string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "append to shebang line",
+			script: "#!/usr/bin/env apko-shell\n#!apko-shell -p curl --ssh\necho hi\n",
+			add:    []string{"jq", "yq"},
+			want:   "#!/usr/bin/env apko-shell\n#!apko-shell -p curl,jq,yq --ssh\necho hi\n",
+		},
+		{
+			name:   "remove from shebang line",
+			script: "#!/usr/bin/env apko-shell\n#!apko-shell -p curl,jq --packages=yq\necho hi\n",
+			remove: []string{"jq", "yq"},
+			want:   "#!/usr/bin/env apko-shell\n#!apko-shell -p curl\necho hi\n",
+		},
+		{
+			name:   "removing the last argument drops the line",
+			script: "#!/usr/bin/env apko-shell\n#!apko-shell -p jq\n#!apko-shell --ssh\necho hi\n",
+			remove: []string{"jq"},
+			want:   "#!/usr/bin/env apko-shell\n#!apko-shell --ssh\necho hi\n",
+		},
+		{
+			name: "block list keeps comments",
+			script: `#!/usr/bin/env apko-shell
+# /// apko
+# contents:
+#   packages:
+#     - git # for cloning
+#     - jq=1.6-r0
+#   # repositories below
+# ///
+`,
+			add:    []string{"yq", "jq"},
+			remove: []string{"git"},
+			want: `#!/usr/bin/env apko-shell
+# /// apko
+# contents:
+#   packages:
+#     - jq
+#     - yq
+#   # repositories below
+# ///
+`,
+		},
+		{
+			name:   "flow list",
+			script: "#!/usr/bin/env apko-shell\n# /// apko\n# contents:\n#   packages: [git, jq] # tools\n# ///\n",
+			add:    []string{"git=2.45.0-r0", "yq"},
+			remove: []string{"jq"},
+			want:   "#!/usr/bin/env apko-shell\n# /// apko\n# contents:\n#   packages: [git=2.45.0-r0, yq] # tools\n# ///\n",
+		},
+		{
+			name:   "removing the last block item leaves an empty list",
+			script: "# /// apko\n# contents:\n#   packages:\n#     - jq\n# ///\n",
+			remove: []string{"jq"},
+			want:   "# /// apko\n# contents:\n#   packages: []\n# ///\n",
+		},
+		{
+			name:   "pinned version replaces the declaration",
+			script: "#!/usr/bin/env apko-shell\n#!apko-shell -p jq,curl\n",
+			add:    []string{"jq=1.7.1-r0"},
+			want:   "#!/usr/bin/env apko-shell\n#!apko-shell -p jq=1.7.1-r0,curl\n",
+		},
+		{
+			name:   "new shebang line after the interpreter line",
+			script: "#!/usr/bin/env apko-shell\n# /// apko\n# environment:\n#   A: b\n# ///\necho hi",
+			add:    []string{"jq"},
+			want:   "#!/usr/bin/env apko-shell\n#!apko-shell -p jq\n# /// apko\n# environment:\n#   A: b\n# ///\necho hi",
+		},
+		{
+			name:   "replacing a block item keeps the spacing of its comment",
+			script: "# /// apko\n# contents:\n#   packages:\n#     - git  # vcs\n#     - jq\t# json\n# ///\n",
+			add:    []string{"git=2.45.0-r0", "jq=1.7.1-r0"},
+			want:   "# /// apko\n# contents:\n#   packages:\n#     - git=2.45.0-r0  # vcs\n#     - jq=1.7.1-r0\t# json\n# ///\n",
+		},
+		{
+			name:   "quoted shebang values",
+			script: "#!/usr/bin/env apko-shell\n#!apko-shell --packages=\"curl,jq\" -p 'git'\n",
+			add:    []string{"yq"},
+			remove: []string{"jq", "git"},
+			want:   "#!/usr/bin/env apko-shell\n#!apko-shell --packages=\"curl,yq\"\n",
+		},
+		{
+			name:   "combined shorthands",
+			script: "#!/usr/bin/env apko-shell\n#!apko-shell -ip jq --ssh\n",
+			remove: []string{"jq"},
+			want:   "#!/usr/bin/env apko-shell\n#!apko-shell -i --ssh\n",
+		},
+		{
+			name:   "values of other flags are not packages",
+			script: "#!/usr/bin/env apko-shell\n#!apko-shell -c '-p jq' -p=curl\n",
+			add:    []string{"jq"},
+			want:   "#!/usr/bin/env apko-shell\n#!apko-shell -c '-p jq' -p=curl,jq\n",
+		},
+		{
+			name:    "other comment syntaxes",
+			script:  "//go:build ignore\n\n//!apko-shell -p go\npackage main\n",
+			comment: "//",
+			add:     []string{"git"},
+			want:    "//go:build ignore\n\n//!apko-shell -p go,git\npackage main\n",
+		},
+		{
+			name:    "removing an undeclared package",
+			script:  "#!/usr/bin/env apko-shell\n#!apko-shell -p curl\n",
+			remove:  []string{"jq"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EditPackages([]byte(tt.script), tt.comment, tt.add, tt.remove)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EditPackages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.want {
+				t.Errorf("EditPackages() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Error is a problem with a script's metadata, located in the script
+type Error struct {
+	// Line and column in the script, starting at 1; Column is 0 when unknown
+	Line   int
+	Column int
+
+	Msg string
+}
+
+func (e *Error) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// source is the content of a PEP 723 block, remembering where each of its
+// lines sits in the script
+type source struct {
+	// Line of the opening "# /// TYPE" marker
+	start int
+
+	lines   []string
+	lineNum []int // script line of each content line
+	offset  []int // bytes of comment prefix removed from each line
+}
+
+func (s *source) add(line string, lineNum, offset int) {
+	s.lines = append(s.lines, line)
+	s.lineNum = append(s.lineNum, lineNum)
+	s.offset = append(s.offset, offset)
+}
+
+func (s *source) String() string {
+	return strings.Join(s.lines, "\n")
+}
+
+// errorAt returns an Error at a 1-based line and column of the block
+// content. Positions outside the content are reported at the opening
+// marker.
+func (s *source) errorAt(line, col int, msg string) *Error {
+	if line < 1 || line > len(s.lines) {
+		return &Error{Line: s.start, Msg: msg}
+	}
+	if col > 0 {
+		col += s.offset[line-1]
+	}
+	return &Error{Line: s.lineNum[line-1], Column: col, Msg: msg}
+}
+
+var (
+	yamlLineError  = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	yamlFieldError = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+)
+
+// yamlError maps a yaml.v3 decoding error onto the script
+func (s *source) yamlError(err error) error {
+	var msgs []string
+	if te, ok := err.(*yaml.TypeError); ok {
+		msgs = te.Errors
+	} else {
+		msgs = []string{err.Error()}
+	}
+
+	var errs []error
+	for _, msg := range msgs {
+		m := yamlLineError.FindStringSubmatch(msg)
+		if m == nil {
+			errs = append(errs, &Error{Line: s.start, Msg: strings.TrimPrefix(msg, "yaml: ")})
+			continue
+		}
+
+		line, _ := strconv.Atoi(m[1])
+		msg, col := m[2], 0
+		if f := yamlFieldError.FindStringSubmatch(msg); f != nil {
+			msg = fmt.Sprintf("unknown field %q", f[1])
+			if line >= 1 && line <= len(s.lines) {
+				col = strings.Index(s.lines[line-1], f[1]) + 1
+			}
+		}
+		errs = append(errs, s.errorAt(line, col, msg))
+	}
+	return errors.Join(errs...)
+}
+
+// tomlError maps a TOML decoding error onto the script
+func (s *source) tomlError(err error) error {
+	var pe toml.ParseError
+	if errors.As(err, &pe) {
+		return s.errorAt(pe.Position.Line, pe.Position.Col, pe.Message)
+	}
+	return &Error{Line: s.start, Msg: err.Error()}
+}
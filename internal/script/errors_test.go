@@ -0,0 +1,130 @@
+package script
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorLocations(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		wantLine   int
+		wantColumn int
+		wantMsg    string
+	}{
+		{
+			name: "unknown field",
+			script: `#!/usr/bin/env apko-shell
+# /// apko
+# contents:
+#   pakages: [curl]
+# ///`,
+			wantLine:   4,
+			wantColumn: 5,
+			wantMsg:    `unknown field "pakages"`,
+		},
+		{
+			name: "unknown top-level field",
+			script: `# /// apko
+# port: [8080]
+# ///`,
+			wantLine:   2,
+			wantColumn: 3,
+			wantMsg:    `unknown field "port"`,
+		},
+		{
+			name: "malformed YAML",
+			script: `#!/usr/bin/env apko-shell
+#!apko-shell -p curl
+# /// apko
+# contents:
+#   packages: [curl
+# ///`,
+			// yaml.v3 reports unclosed flow sequences at their enclosing key
+			wantLine: 4,
+		},
+		{
+			name: "wrong type",
+			script: `# /// apko
+# ports: 8080
+# ///`,
+			wantLine: 2,
+			wantMsg:  "cannot unmarshal",
+		},
+		{
+			name: "unterminated block",
+			script: `#!/usr/bin/env apko-shell
+# /// apko
+# contents:
+#   packages: [curl]
+echo hi`,
+			wantLine: 5,
+			wantMsg:  `unterminated PEP 723 apko block opened on line 2, missing closing "# ///"`,
+		},
+		{
+			name: "unterminated block closed after code",
+			script: `#!/usr/bin/env apko-shell
+# /// apko
+# contents:
+#   packages: [curl]
+echo hi
+
+# ///`,
+			wantLine: 5,
+			wantMsg:  `unterminated PEP 723 apko block opened on line 2`,
+		},
+		{
+			name: "blank line in a block",
+			script: `# /// apko
+# contents:
+
+#   packages: [curl]
+# ///`,
+			wantLine: 3,
+			wantMsg:  `unterminated PEP 723 apko block opened on line 1`,
+		},
+		{
+			name: "unterminated block at the end of the script",
+			script: `#!/usr/bin/env apko-shell
+# /// apko
+# contents:
+#   packages: [curl]`,
+			wantLine: 2,
+			wantMsg:  `unterminated PEP 723 apko block, missing closing "# ///"`,
+		},
+		{
+			name: "malformed TOML",
+			script: `# /// script
+# dependencies = ["requests"]
+# requires-python = >=3.11
+# ///`,
+			wantLine:   3,
+			wantColumn: 21,
+		},
+		{
+			name: "unterminated block with another comment syntax",
+			script: `// /// apko
+// contents: {}`,
+			wantLine: 1,
+			wantMsg:  `missing closing "// ///"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.script))
+			var serr *Error
+			if !errors.As(err, &serr) {
+				t.Fatalf("Parse() error = %v, want *Error", err)
+			}
+			if serr.Line != tt.wantLine || (tt.wantColumn != 0 && serr.Column != tt.wantColumn) {
+				t.Errorf("Parse() error at %d:%d, want %d:%d (%v)", serr.Line, serr.Column, tt.wantLine, tt.wantColumn, err)
+			}
+			if !strings.Contains(serr.Msg, tt.wantMsg) {
+				t.Errorf("Parse() error = %q, want it to contain %q", serr.Msg, tt.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package script
+
+import (
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// interpreterPackages maps interpreter commands to the packages providing them
+var interpreterPackages = map[string]string{
+	"sh":      "busybox",
+	"bash":    "bash",
+	"python":  "python3",
+	"python3": "python3",
+	"node":    "nodejs",
+	"ruby":    "ruby",
+	"perl":    "perl",
+	"go":      "go",
+}
+
+// shells are the interpreters of shell scripts
+var shells = []string{"sh", "ash", "bash", "dash", "ksh", "mksh", "zsh"}
+
+// extensionInterpreters maps file extensions to the interpreters that
+// conventionally run them
+var extensionInterpreters = map[string]string{
+	".py":   "python3",
+	".js":   "node",
+	".mjs":  "node",
+	".cjs":  "node",
+	".rb":   "ruby",
+	".pl":   "perl",
+	".bash": "bash",
+	".go":   "go run",
+}
+
+// Interpreter returns the command that runs the script at path: the PEP
+// 723 block's cmd when set, then the Python selected by a "script" block,
+// otherwise the interpreter conventionally used for the file extension.
+// It returns nil when the script should run under the configured shell.
+func (c *Config) Interpreter(scriptPath string) []string {
+	if c.ImageConfig != nil && c.ImageConfig.Cmd != "" {
+		return strings.Fields(c.ImageConfig.Cmd)
+	}
+
+	if c.Python != nil {
+		return c.Python.Interpreter()
+	}
+
+	if interp, ok := extensionInterpreters[strings.ToLower(filepath.Ext(scriptPath))]; ok {
+		return strings.Fields(interp)
+	}
+
+	return nil
+}
+
+// InterpreterPackage returns the package providing an interpreter command,
+// which may be given as a bare name or a path
+func InterpreterPackage(command string) (string, bool) {
+	pkg, ok := interpreterPackages[path.Base(command)]
+	return pkg, ok
+}
+
+// IsShell reports whether an interpreter command, given as a bare name or a
+// path, is a shell
+func IsShell(command string) bool {
+	return slices.Contains(shells, path.Base(command))
+}
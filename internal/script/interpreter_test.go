@@ -0,0 +1,113 @@
+package script
+
+import (
+	"strings"
+	"testing"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestInterpreter(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		config *Config
+		want   []string
+	}{
+		{
+			name:   "shell script",
+			path:   "build.sh",
+			config: &Config{},
+			want:   nil,
+		},
+		{
+			name:   "no extension",
+			path:   "tool",
+			config: &Config{},
+			want:   nil,
+		},
+		{
+			name:   "python by extension",
+			path:   "scripts/hello.py",
+			config: &Config{},
+			want:   []string{"python3"},
+		},
+		{
+			name:   "node by extension",
+			path:   "index.MJS",
+			config: &Config{},
+			want:   []string{"node"},
+		},
+		{
+			name:   "go run by extension",
+			path:   "cmd/tool.go",
+			config: &Config{},
+			want:   []string{"go", "run"},
+		},
+		{
+			name: "block cmd wins over extension",
+			path: "hello.py",
+			config: &Config{
+				ImageConfig: &types.ImageConfiguration{Cmd: "/usr/bin/python3 -u"},
+			},
+			want: []string{"/usr/bin/python3", "-u"},
+		},
+		{
+			name: "block without cmd",
+			path: "hello.rb",
+			config: &Config{
+				ImageConfig: &types.ImageConfiguration{},
+			},
+			want: []string{"ruby"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.config.Interpreter(tt.path)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Interpreter(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpreterPackage(t *testing.T) {
+	tests := []struct {
+		command string
+		want    string
+		wantOK  bool
+	}{
+		{command: "/bin/sh", want: "busybox", wantOK: true},
+		{command: "/bin/bash", want: "bash", wantOK: true},
+		{command: "python3", want: "python3", wantOK: true},
+		{command: "/usr/bin/node", want: "nodejs", wantOK: true},
+		{command: "/opt/custom/interp"},
+	}
+
+	for _, tt := range tests {
+		got, ok := InterpreterPackage(tt.command)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("InterpreterPackage(%q) = %q, %v; want %q, %v", tt.command, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestIsShell(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{command: "/bin/sh", want: true},
+		{command: "bash", want: true},
+		{command: "/usr/bin/zsh", want: true},
+		{command: "python3"},
+		{command: "uv"},
+	}
+
+	for _, tt := range tests {
+		if got := IsShell(tt.command); got != tt.want {
+			t.Errorf("IsShell(%q) = %v, want %v", tt.command, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package script
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// pythonPackage matches the names of packaged Python release lines, such
+// as python-3.12
+var pythonPackage = regexp.MustCompile(`^python-(\d+)\.(\d+)$`)
+
+// PythonScript is the metadata of a standard PEP 723 "script" block
+type PythonScript struct {
+	// PEP 508 requirements the script imports
+	Dependencies []string `toml:"dependencies"`
+
+	// PEP 440 version specifier for the Python interpreter
+	RequiresPython string `toml:"requires-python"`
+
+	// Release line chosen by SelectPython, nil for python3
+	version *pythonVersion
+}
+
+func parsePythonScript(src *source, cfg *Config) error {
+	var p PythonScript
+	if _, err := toml.Decode(src.String(), &p); err != nil {
+		return src.tomlError(err)
+	}
+
+	if _, err := p.specifiers(); err != nil {
+		return &Error{Line: src.start, Msg: err.Error()}
+	}
+
+	cfg.Python = &p
+	return nil
+}
+
+// Packages returns the packages needed to run the script: the Python
+// chosen by SelectPython, or python3, plus uv when there are dependencies
+// to install
+func (p *PythonScript) Packages() []string {
+	pkgs := []string{"python3"}
+	if p.version != nil {
+		pkgs[0] = "python-" + p.version.String()
+	}
+	if len(p.Dependencies) > 0 {
+		pkgs = append(pkgs, "uv")
+	}
+	return pkgs
+}
+
+// Interpreter returns the command running the script. Scripts with
+// dependencies run through uv, which installs them into a cached
+// environment; others run directly on the selected Python.
+func (p *PythonScript) Interpreter() []string {
+	if len(p.Dependencies) > 0 {
+		return []string{"uv", "run", "--script"}
+	}
+	if p.version != nil {
+		return []string{"python" + p.version.String()}
+	}
+	return []string{"python3"}
+}
+
+// SelectPython chooses the newest Python release line among the available
+// packages, such as python-3.12, that satisfies requires-python. Scripts
+// accepting any version keep python3.
+func (p *PythonScript) SelectPython(available []string) error {
+	clauses, err := p.specifiers()
+	if err != nil || len(clauses) == 0 {
+		return err
+	}
+
+	var versions []pythonVersion
+	for _, name := range available {
+		m := pythonPackage.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		major, _ := strconv.Atoi(m[1])
+		minor, _ := strconv.Atoi(m[2])
+		versions = append(versions, pythonVersion{major, minor})
+	}
+	slices.SortFunc(versions, func(a, b pythonVersion) int { return a.compare(b.Major, b.Minor) })
+
+	for _, v := range slices.Backward(versions) {
+		if !slices.ContainsFunc(clauses, func(c specifier) bool { return !c.allows(v) }) {
+			p.version = &v
+			return nil
+		}
+	}
+
+	names := make([]string, len(versions))
+	for i, v := range versions {
+		names[i] = v.String()
+	}
+	return fmt.Errorf("no packaged Python satisfies requires-python %q (available: %s)", p.RequiresPython, strings.Join(names, ", "))
+}
+
+// specifiers parses requires-python, which is empty when the script
+// accepts any version
+func (p *PythonScript) specifiers() ([]specifier, error) {
+	if strings.TrimSpace(p.RequiresPython) == "" {
+		return nil, nil
+	}
+
+	var clauses []specifier
+	for _, s := range strings.Split(p.RequiresPython, ",") {
+		c, err := parseSpecifier(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("invalid requires-python %q: %w", p.RequiresPython, err)
+		}
+		clauses = append(clauses, c)
+	}
+	return clauses, nil
+}
+
+// pythonVersion is a Python release line
+type pythonVersion struct {
+	Major, Minor int
+}
+
+func (v pythonVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+func (v pythonVersion) compare(major, minor int) int {
+	switch {
+	case v.Major != major:
+		return v.Major - major
+	default:
+		return v.Minor - minor
+	}
+}
+
+// specifier is a single PEP 440 version clause such as ">=3.11"
+type specifier struct {
+	op       string
+	major    int
+	minor    int
+	hasMinor bool
+	patch    int
+	hasPatch bool
+	wildcard bool
+}
+
+func parseSpecifier(s string) (specifier, error) {
+	var sp specifier
+	for _, op := range []string{"~=", "==", "!=", ">=", "<=", ">", "<"} {
+		if rest, ok := strings.CutPrefix(s, op); ok {
+			sp.op = op
+			s = strings.TrimSpace(rest)
+			break
+		}
+	}
+	if sp.op == "" {
+		return sp, fmt.Errorf("missing operator in %q", s)
+	}
+
+	if rest, ok := strings.CutSuffix(s, ".*"); ok {
+		if sp.op != "==" && sp.op != "!=" {
+			return sp, fmt.Errorf("wildcard not allowed with %s", sp.op)
+		}
+		sp.wildcard = true
+		s = rest
+	}
+
+	parts := strings.Split(s, ".")
+	nums := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return sp, fmt.Errorf("invalid version %q", s)
+		}
+		nums[i] = n
+	}
+
+	sp.major = nums[0]
+	if len(nums) > 1 {
+		sp.minor = nums[1]
+		sp.hasMinor = true
+	}
+	if len(nums) > 2 {
+		sp.patch = nums[2]
+		sp.hasPatch = true
+	}
+	if sp.op == "~=" && len(nums) < 2 {
+		return sp, fmt.Errorf("~= requires at least two version components")
+	}
+	return sp, nil
+}
+
+// allows reports whether any release of the line v satisfies the clause
+func (sp specifier) allows(v pythonVersion) bool {
+	c := v.compare(sp.major, sp.minor)
+	if !sp.hasMinor && (sp.op == "==" || sp.op == "!=") {
+		// "==3.*" matches every release line of the major version
+		c = v.Major - sp.major
+	}
+	switch sp.op {
+	case ">=", ">":
+		return c >= 0
+	case "<=":
+		return c <= 0
+	case "<":
+		if sp.hasPatch && sp.patch > 0 {
+			return c <= 0
+		}
+		return c < 0
+	case "==":
+		return c == 0
+	case "!=":
+		// Only a wildcard excludes the whole release line
+		return !sp.wildcard || c != 0
+	case "~=":
+		if sp.hasPatch {
+			return c == 0
+		}
+		return c >= 0 && v.Major == sp.major
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package script
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePythonScript(t *testing.T) {
+	tests := []struct {
+		name            string
+		script          string
+		wantPython      bool
+		wantDeps        []string
+		wantPackages    []string
+		wantInterpreter []string
+		wantHasYAML     bool
+		wantErr         bool
+	}{
+		{
+			name: "dependencies",
+			script: `#!/usr/bin/env apko-shell
+# /// script
+# dependencies = [
+#   "requests",
+#   "rich>=13",
+# ]
+# ///
+import requests`,
+			wantPython:      true,
+			wantDeps:        []string{"requests", "rich>=13"},
+			wantPackages:    []string{"python3", "uv"},
+			wantInterpreter: []string{"uv", "run", "--script"},
+		},
+		{
+			name: "requires-python without dependencies",
+			script: `# /// script
+# requires-python = ">=3.11,<3.13"
+# ///`,
+			wantPython:      true,
+			wantPackages:    []string{"python3"},
+			wantInterpreter: []string{"python3"},
+		},
+		{
+			name: "apko block alongside script block",
+			script: `#!/usr/bin/env apko-shell
+# /// apko
+# contents:
+#   packages: [git]
+# ///
+# /// script
+# requires-python = "~=3.10.4"
+# dependencies = ["httpx"]
+# ///`,
+			wantPython:      true,
+			wantDeps:        []string{"httpx"},
+			wantPackages:    []string{"python3", "uv"},
+			wantInterpreter: []string{"uv", "run", "--script"},
+			wantHasYAML:     true,
+		},
+		{
+			name: "other tools' blocks are ignored",
+			script: `# /// pyproject
+# [tool.ruff]
+# ///`,
+		},
+		{
+			// Whether a packaged Python satisfies it is up to SelectPython
+			name: "requires-python newer than any known Python",
+			script: `# /// script
+# requires-python = ">=4"
+# ///`,
+			wantPython:      true,
+			wantPackages:    []string{"python3"},
+			wantInterpreter: []string{"python3"},
+		},
+		{
+			name: "invalid requires-python",
+			script: `# /// script
+# requires-python = ">=3.x"
+# ///`,
+			wantErr: true,
+		},
+		{
+			name: "invalid TOML",
+			script: `# /// script
+# dependencies = [
+# ///`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Parse(strings.NewReader(tt.script))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if (cfg.ImageConfig != nil) != tt.wantHasYAML {
+				t.Errorf("Parse() ImageConfig = %v, wantHasYAML %v", cfg.ImageConfig, tt.wantHasYAML)
+			}
+			if (cfg.Python != nil) != tt.wantPython {
+				t.Fatalf("Parse() Python = %v, want present %v", cfg.Python, tt.wantPython)
+			}
+			if cfg.Python == nil {
+				return
+			}
+
+			if got := strings.Join(cfg.Python.Dependencies, " "); got != strings.Join(tt.wantDeps, " ") {
+				t.Errorf("Dependencies = %v, want %v", cfg.Python.Dependencies, tt.wantDeps)
+			}
+			if got := strings.Join(cfg.Python.Packages(), " "); got != strings.Join(tt.wantPackages, " ") {
+				t.Errorf("Packages() = %v, want %v", cfg.Python.Packages(), tt.wantPackages)
+			}
+			if got := strings.Join(cfg.Interpreter("tool"), " "); got != strings.Join(tt.wantInterpreter, " ") {
+				t.Errorf("Interpreter() = %v, want %v", cfg.Interpreter("tool"), tt.wantInterpreter)
+			}
+		})
+	}
+}
+
+func TestSelectPython(t *testing.T) {
+	// Release lines come from the repository, in no particular order
+	available := []string{"python-3.12", "python-3.10", "python-3.14", "python-3.13", "python-3.11", "python-3.12-dev", "py3.13-pip", "python3"}
+
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "", want: ""},
+		{spec: ">=3.8", want: "3.14"},
+		{spec: ">=3.14", want: "3.14"},
+		{spec: ">=3.11, <3.13", want: "3.12"},
+		{spec: "<3.12.1", want: "3.12"},
+		{spec: "==3.11.*", want: "3.11"},
+		{spec: "==3.*", want: "3.14"},
+		{spec: "!=3.14.*", want: "3.13"},
+		{spec: "!=3.14.1", want: "3.14"},
+		{spec: "~=3.11", want: "3.14"},
+		{spec: "~=3.11.2", want: "3.11"},
+		{spec: "<3.10", wantErr: true},
+		{spec: ">=3.15", wantErr: true},
+		{spec: "3.12", wantErr: true},
+		{spec: ">=3.x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		p := &PythonScript{RequiresPython: tt.spec}
+		err := p.SelectPython(available)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SelectPython(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		wantPkg, wantInterp := "python3", "python3"
+		if tt.want != "" {
+			wantPkg, wantInterp = "python-"+tt.want, "python"+tt.want
+		}
+		if got := p.Packages()[0]; got != wantPkg {
+			t.Errorf("SelectPython(%q) package = %s, want %s", tt.spec, got, wantPkg)
+		}
+		if got := p.Interpreter()[0]; got != wantInterp {
+			t.Errorf("SelectPython(%q) interpreter = %s, want %s", tt.spec, got, wantInterp)
+		}
+	}
+}
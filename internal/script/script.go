@@ -2,8 +2,10 @@ package script
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 
 	"chainguard.dev/apko/pkg/build/types"
@@ -15,55 +17,150 @@ type Config struct {
 	// Raw argument strings from #!apko-shell lines
 	ShebangArgs []string
 
+	// Arguments from #!apko-shell lines, split with shell quoting rules
+	ShebangTokens []Token
+
 	// Parsed YAML from PEP 723 block
 	ImageConfig *types.ImageConfiguration
+
+	// Ports to publish from the PEP 723 block
+	Ports []string
+
+	// Cache mounts from the PEP 723 block
+	Caches []string
+
+	// Host directory receiving the script's outputs, from the PEP 723 block
+	Artifacts string
+
+	// Python metadata from a standard PEP 723 "script" block
+	Python *PythonScript
+
+	// Where the metadata was found, for editing it
+	layout layout
 }
 
-// Parse reads a script and extracts configuration from shebang and PEP 723 blocks
+// layout locates the metadata lines of a script by 0-based line index
+type layout struct {
+	// Comment syntax of the header, "#" when there is none
+	comment string
+
+	// Index of the interpreter line, or -1
+	interpreter int
+
+	// Indexes of the #!apko-shell lines
+	shebangs []int
+
+	// Content of the first apko block, if any
+	apko *source
+}
+
+// block is the schema of the PEP 723 block: an apko image configuration
+// extended with apko-shell specific keys
+type block struct {
+	types.ImageConfiguration `yaml:",inline"`
+
+	// Ports to publish, in [[hostIP:]hostPort:]containerPort[/protocol] form
+	Ports []string `yaml:"ports,omitempty"`
+
+	// Cache mounts, in NAME:PATH or preset form
+	Caches []string `yaml:"caches,omitempty"`
+
+	// Host directory, relative to the script, to copy /apko-shell/out into
+	Artifacts string `yaml:"artifacts,omitempty"`
+}
+
+// Parse reads a script and extracts configuration from shebang and PEP 723
+// blocks. The comment syntax is detected from the script's first line.
 func Parse(r io.Reader) (*Config, error) {
-	cfg := &Config{}
+	return parse(r, "")
+}
+
+// ParseFile reads the script at path, using the comment syntax conventional
+// for its extension and falling back to detecting it from the first line
+func ParseFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening script: %w", err)
+	}
+	defer f.Close()
+
+	return parse(f, CommentPrefix(path))
+}
+
+func parse(r io.Reader, comment string) (*Config, error) {
+	cfg := &Config{layout: layout{interpreter: -1}}
 
 	scanner := bufio.NewScanner(r)
 	var lineNum int
-	var inPEP723 bool
-	var pep723Lines []string
+	var blockType string
+	var src *source
 
 	for scanner.Scan() {
 		lineNum++
 		line := scanner.Text()
 
-		// Handle PEP 723 block
-		if strings.HasPrefix(line, "# /// apko") {
-			inPEP723 = true
+		// An interpreter line is not a comment in every language, skip it
+		if lineNum == 1 && strings.HasPrefix(line, "#!") && !strings.HasPrefix(line, "#!apko-shell") {
+			cfg.layout.interpreter = 0
 			continue
 		}
-		if inPEP723 {
-			if strings.HasPrefix(line, "# ///") {
-				// End of PEP 723 block, parse it
-				if err := parsePEP723(strings.Join(pep723Lines, "\n"), cfg); err != nil {
-					return nil, fmt.Errorf("parsing PEP 723 block: %w", err)
-				}
+
+		// Blank lines separate header comments, e.g. after a build constraint
+		if strings.TrimSpace(line) == "" && blockType == "" {
+			continue
+		}
+
+		if comment == "" {
+			comment = detectComment(line)
+			if comment == "" {
 				break
 			}
-			// Remove "# " prefix and collect line
-			if strings.HasPrefix(line, "# ") {
-				pep723Lines = append(pep723Lines, line[2:])
-			} else if strings.HasPrefix(line, "#") {
-				pep723Lines = append(pep723Lines, line[1:])
+		}
+
+		body, isComment := strings.CutPrefix(line, comment)
+
+		// Handle PEP 723 blocks, "# /// TYPE" through "# ///"
+		if blockType == "" {
+			if t, ok := strings.CutPrefix(body, " /// "); isComment && ok && strings.TrimSpace(t) != "" {
+				blockType = strings.TrimSpace(t)
+				src = &source{start: lineNum}
+				continue
+			}
+		} else {
+			// Every line of a block is a comment, so code ends it early
+			if !isComment {
+				return nil, &Error{
+					Line: lineNum,
+					Msg:  fmt.Sprintf("unterminated PEP 723 %s block opened on line %d, missing closing %q", blockType, src.start, comment+" ///"),
+				}
+			}
+			if strings.TrimRight(body, " \t") == " ///" {
+				if err := parseBlock(blockType, src, cfg); err != nil {
+					return nil, fmt.Errorf("parsing PEP 723 %s block: %w", blockType, err)
+				}
+				if blockType == "apko" && cfg.layout.apko == nil {
+					cfg.layout.apko = src
+				}
+				blockType = ""
+				continue
 			}
+			// Remove the comment prefix and collect line
+			content := strings.TrimPrefix(body, " ")
+			src.add(content, lineNum, len(line)-len(content))
 			continue
 		}
 
 		// Parse shebang lines
-		if strings.HasPrefix(line, "#!apko-shell") {
-			if err := parseShebangLine(line, cfg); err != nil {
-				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		if args, ok := strings.CutPrefix(body, "!apko-shell"); isComment && ok {
+			if err := parseShebangLine(args, lineNum, cfg); err != nil {
+				return nil, &Error{Line: lineNum, Msg: err.Error()}
 			}
+			cfg.layout.shebangs = append(cfg.layout.shebangs, lineNum-1)
 			continue
 		}
 
 		// Stop parsing after first non-shebang, non-comment line
-		if !strings.HasPrefix(line, "#") {
+		if !isComment {
 			break
 		}
 	}
@@ -72,27 +169,63 @@ func Parse(r io.Reader) (*Config, error) {
 		return nil, fmt.Errorf("reading script: %w", err)
 	}
 
+	if blockType != "" {
+		return nil, &Error{
+			Line: src.start,
+			Msg:  fmt.Sprintf("unterminated PEP 723 %s block, missing closing %q", blockType, comment+" ///"),
+		}
+	}
+
+	cfg.layout.comment = comment
+	if comment == "" {
+		cfg.layout.comment = "#"
+	}
 	return cfg, nil
 }
 
-func parseShebangLine(line string, cfg *Config) error {
-	// Remove "#!apko-shell" prefix
-	args := strings.TrimPrefix(line, "#!apko-shell")
+// parseBlock dispatches a PEP 723 block on its type. Blocks of other types
+// belong to other tools and are ignored.
+func parseBlock(blockType string, src *source, cfg *Config) error {
+	switch blockType {
+	case "apko":
+		return parsePEP723(src, cfg)
+	case "script":
+		return parsePythonScript(src, cfg)
+	}
+	return nil
+}
+
+func parseShebangLine(args string, line int, cfg *Config) error {
 	args = strings.TrimSpace(args)
+	if args == "" {
+		return nil
+	}
 
-	if args != "" {
-		cfg.ShebangArgs = append(cfg.ShebangArgs, args)
+	words, err := SplitWords(args)
+	if err != nil {
+		return err
 	}
 
+	cfg.ShebangArgs = append(cfg.ShebangArgs, args)
+	for _, w := range words {
+		cfg.ShebangTokens = append(cfg.ShebangTokens, Token{Value: w, Line: line})
+	}
 	return nil
 }
 
-func parsePEP723(content string, cfg *Config) error {
-	var ic types.ImageConfiguration
-	if err := yaml.Unmarshal([]byte(content), &ic); err != nil {
-		return fmt.Errorf("unmarshaling YAML: %w", err)
+// parsePEP723 strictly decodes the apko block, so that misspelled keys
+// are reported rather than silently ignored
+func parsePEP723(src *source, cfg *Config) error {
+	var b block
+	dec := yaml.NewDecoder(strings.NewReader(src.String()))
+	dec.KnownFields(true)
+	if err := dec.Decode(&b); err != nil && !errors.Is(err, io.EOF) {
+		return src.yamlError(err)
 	}
 
-	cfg.ImageConfig = &ic
+	cfg.ImageConfig = &b.ImageConfiguration
+	cfg.Ports = b.Ports
+	cfg.Caches = b.Caches
+	cfg.Artifacts = b.Artifacts
 	return nil
 }
@@ -11,6 +11,9 @@ func TestParse(t *testing.T) {
 		script      string
 		wantArgs    []string
 		wantHasYAML bool
+		wantPorts   []string
+		wantCaches  []string
+		wantOutput  string
 		wantErr     bool
 	}{
 		{
@@ -74,6 +77,46 @@ echo "hello"`,
 				"--repository https://packages.wolfi.dev/os",
 			},
 		},
+		{
+			name: "PEP 723 block with ports",
+			script: `#!/usr/bin/env apko-shell
+# /// apko
+# contents:
+#   packages:
+#     - python3
+# ports:
+#   - 8000
+#   - 127.0.0.1:8080:80
+# ///
+python3 -m http.server`,
+			wantHasYAML: true,
+			wantPorts:   []string{"8000", "127.0.0.1:8080:80"},
+		},
+		{
+			name: "PEP 723 block with caches",
+			script: `#!/usr/bin/env apko-shell
+# /// apko
+# contents:
+#   packages:
+#     - go
+# caches:
+#   - go
+#   - golangci:~/.cache/golangci-lint
+# ///
+go build ./...`,
+			wantHasYAML: true,
+			wantCaches:  []string{"go", "golangci:~/.cache/golangci-lint"},
+		},
+		{
+			name: "PEP 723 block with artifacts",
+			script: `#!/usr/bin/env apko-shell
+# /// apko
+# artifacts: dist
+# ///
+tar czf /apko-shell/out/release.tgz .`,
+			wantHasYAML: true,
+			wantOutput:  "dist",
+		},
 	}
 
 	for _, tt := range tests {
@@ -101,6 +144,21 @@ echo "hello"`,
 			if !tt.wantHasYAML && cfg.ImageConfig != nil {
 				t.Errorf("Parse() ImageConfig = non-nil, want nil")
 			}
+
+			// Check ports
+			if strings.Join(cfg.Ports, " ") != strings.Join(tt.wantPorts, " ") {
+				t.Errorf("Parse() Ports = %v, want %v", cfg.Ports, tt.wantPorts)
+			}
+
+			// Check caches
+			if strings.Join(cfg.Caches, " ") != strings.Join(tt.wantCaches, " ") {
+				t.Errorf("Parse() Caches = %v, want %v", cfg.Caches, tt.wantCaches)
+			}
+
+			// Check artifacts
+			if cfg.Artifacts != tt.wantOutput {
+				t.Errorf("Parse() Artifacts = %q, want %q", cfg.Artifacts, tt.wantOutput)
+			}
 		})
 	}
 }
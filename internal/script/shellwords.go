@@ -0,0 +1,101 @@
+package script
+
+import (
+	"errors"
+	"strings"
+)
+
+// Token is a shebang argument along with the script line it came from
+type Token struct {
+	Value string
+	Line  int
+}
+
+// SplitWords splits s into words following POSIX shell quoting rules:
+// single quotes are literal, double quotes allow backslash escapes of
+// $ ` " and \, an unquoted backslash escapes the next character, and an
+// unquoted # starting a word begins a comment. No expansion is performed.
+func SplitWords(s string) ([]string, error) {
+	words, err := splitWords(s)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(words))
+	for i, w := range words {
+		values[i] = w.value
+	}
+	return values, nil
+}
+
+// word is a word of a string split by splitWords
+type word struct {
+	value string
+
+	// Byte range of the word, quotes included, in the split string
+	start, end int
+}
+
+// splitWords splits s like SplitWords, keeping the position of each word
+func splitWords(s string) ([]word, error) {
+	var words []word
+	var buf strings.Builder
+	start := -1
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if start < 0 && c != ' ' && c != '\t' && c != '\n' && c != '#' {
+			start = i
+		}
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if start >= 0 {
+				words = append(words, word{value: buf.String(), start: start, end: i})
+				buf.Reset()
+				start = -1
+			}
+
+		case c == '#' && start < 0:
+			return words, nil
+
+		case c == '\\':
+			if i+1 >= len(s) {
+				return nil, errors.New("trailing backslash")
+			}
+			i++
+			buf.WriteByte(s[i])
+
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			buf.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+
+		case c == '"':
+			closed := false
+			for i++; i < len(s); i++ {
+				if s[i] == '"' {
+					closed = true
+					break
+				}
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\\n", s[i+1]) >= 0 {
+					i++
+				}
+				buf.WriteByte(s[i])
+			}
+			if !closed {
+				return nil, errors.New("unterminated double quote")
+			}
+
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	if start >= 0 {
+		words = append(words, word{value: buf.String(), start: start, end: len(s)})
+	}
+	return words, nil
+}
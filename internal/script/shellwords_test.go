@@ -0,0 +1,64 @@
+package script
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "-p curl,jq", want: []string{"-p", "curl,jq"}},
+		{in: `-c "echo hi"`, want: []string{"-c", "echo hi"}},
+		{in: `MSG="hello world"`, want: []string{"MSG=hello world"}},
+		{in: `-c 'echo "$HOME"'`, want: []string{"-c", `echo "$HOME"`}},
+		{in: `"a \"b\" \$c \d"`, want: []string{`a "b" $c \d`}},
+		{in: `hello\ world`, want: []string{"hello world"}},
+		{in: `-p curl # needs curl`, want: []string{"-p", "curl"}},
+		{in: `a#b`, want: []string{"a#b"}},
+		{in: `''`, want: []string{""}},
+		{in: "  \t ", want: nil},
+		{in: `"open`, wantErr: true},
+		{in: `'open`, wantErr: true},
+		{in: `trailing\`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := SplitWords(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SplitWords(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+			t.Errorf("SplitWords(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestShebangTokens(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(`#!/usr/bin/env apko-shell
+#!apko-shell -p curl
+#!apko-shell -c "echo hi"
+echo`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Token{{"-p", 2}, {"curl", 2}, {"-c", 3}, {"echo hi", 3}}
+	if len(cfg.ShebangTokens) != len(want) {
+		t.Fatalf("ShebangTokens = %v, want %v", cfg.ShebangTokens, want)
+	}
+	for i := range want {
+		if cfg.ShebangTokens[i] != want[i] {
+			t.Errorf("ShebangTokens[%d] = %v, want %v", i, cfg.ShebangTokens[i], want[i])
+		}
+	}
+
+	_, err = Parse(strings.NewReader("#!/usr/bin/env apko-shell\n\n#!apko-shell -c \"echo\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Parse() error = %v, want one mentioning line 3", err)
+	}
+}
@@ -0,0 +1,164 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a session does not exist in the store
+var ErrNotFound = errors.New("session not found")
+
+// validName matches the names docker accepts for containers
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Session records a long-lived container started by apko-shell
+type Session struct {
+	// User-facing session name
+	Name string `json:"name"`
+
+	// Runtime-specific container ID
+	ContainerID string `json:"containerID"`
+
+	// Name of the runtime that owns the container
+	Runtime string `json:"runtime"`
+
+	// Host directory mounted as the workspace
+	WorkDir string `json:"workDir"`
+
+	// Shell used when attaching
+	Shell string `json:"shell"`
+
+	// Packages installed in the session image
+	Packages []string `json:"packages,omitempty"`
+
+	// When the session was started
+	Created time.Time `json:"created"`
+}
+
+// ContainerName returns the container name used for a session
+func ContainerName(name string) string {
+	return "apko-shell-" + name
+}
+
+// ValidateName checks that name can be used as a session name
+func ValidateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid session name %q: must match %s", name, validName)
+	}
+	return nil
+}
+
+// Store persists session state as JSON files in a directory
+type Store struct {
+	dir string
+}
+
+// NewStore creates a Store rooted at dir
+func NewStore(dir string) *Store {
+	return &Store{
+		dir: dir,
+	}
+}
+
+// Get loads the session with the given name
+func (s *Store) Get(name string) (*Session, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading session: %w", err)
+	}
+
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("decoding session %s: %w", name, err)
+	}
+
+	return &sess, nil
+}
+
+// Save writes the session, replacing any existing state with the same name
+func (s *Store) Save(sess *Session) error {
+	if err := ValidateName(sess.Name); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("creating session dir: %w", err)
+	}
+
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding session: %w", err)
+	}
+
+	if err := os.WriteFile(s.path(sess.Name), data, 0o644); err != nil {
+		return fmt.Errorf("writing session: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the session with the given name
+func (s *Store) Delete(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	err := os.Remove(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return fmt.Errorf("removing session: %w", err)
+	}
+
+	return nil
+}
+
+// List returns all sessions sorted by name
+func (s *Store) List() ([]*Session, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading session dir: %w", err)
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		sess, err := s.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, sess)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Name < sessions[j].Name
+	})
+
+	return sessions, nil
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
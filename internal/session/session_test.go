@@ -0,0 +1,83 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	s := NewStore(t.TempDir())
+
+	// Empty store lists nothing
+	sessions, err := s.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("List() got %d sessions, want 0", len(sessions))
+	}
+
+	for _, name := range []string{"web", "db"} {
+		sess := &Session{
+			Name:        name,
+			ContainerID: "id-" + name,
+			Runtime:     "docker",
+			WorkDir:     "/tmp/" + name,
+			Shell:       "/bin/sh",
+			Packages:    []string{"busybox"},
+			Created:     time.Now(),
+		}
+		if err := s.Save(sess); err != nil {
+			t.Fatalf("Save(%s) error = %v", name, err)
+		}
+	}
+
+	got, err := s.Get("web")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.ContainerID != "id-web" {
+		t.Errorf("Get() ContainerID = %q, want %q", got.ContainerID, "id-web")
+	}
+
+	sessions, err = s.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(sessions) != 2 || sessions[0].Name != "db" || sessions[1].Name != "web" {
+		t.Errorf("List() = %v, want [db web]", sessions)
+	}
+
+	if err := s.Delete("web"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := s.Get("web"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete("web"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete() twice error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "dev"},
+		{name: "my-session.2"},
+		{name: "", wantErr: true},
+		{name: "-dev", wantErr: true},
+		{name: "../escape", wantErr: true},
+		{name: "a b", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateName(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
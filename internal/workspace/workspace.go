@@ -0,0 +1,79 @@
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/joshrwolf/apko-shell/internal/runtime"
+)
+
+// Layout describes how a host directory is exposed in the container
+type Layout struct {
+	// Host directory mounted at runtime.WorkspacePath
+	Root string
+
+	// Working directory inside the container
+	WorkDir string
+}
+
+// Resolve computes the layout for running in workDir. When repo is set and
+// workDir is inside a git repository, the repository root is mounted and
+// the working directory points at workDir's location within it, so that
+// files elsewhere in the repository remain reachable.
+func Resolve(workDir string, repo bool) (Layout, error) {
+	abs, err := filepath.Abs(workDir)
+	if err != nil {
+		return Layout{}, fmt.Errorf("resolving workdir: %w", err)
+	}
+
+	root := abs
+	if repo {
+		if repoRoot, ok := FindRepoRoot(abs); ok {
+			root = repoRoot
+		}
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return Layout{}, fmt.Errorf("resolving workdir: %w", err)
+	}
+
+	return Layout{
+		Root:    root,
+		WorkDir: path.Join(runtime.WorkspacePath, filepath.ToSlash(rel)),
+	}, nil
+}
+
+// ContainerPath maps a host path inside Root to its path in the container
+func (l Layout) ContainerPath(hostPath string) (string, bool) {
+	abs, err := filepath.Abs(hostPath)
+	if err != nil {
+		return "", false
+	}
+
+	rel, err := filepath.Rel(l.Root, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	return path.Join(runtime.WorkspacePath, filepath.ToSlash(rel)), true
+}
+
+// FindRepoRoot returns the root of the git repository containing dir. Both
+// regular checkouts and worktrees (where .git is a file) are recognized.
+func FindRepoRoot(dir string) (string, bool) {
+	for {
+		if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,109 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tmp := t.TempDir()
+
+	// A repository with a nested scripts directory
+	repo := filepath.Join(tmp, "repo")
+	scripts := filepath.Join(repo, "scripts", "ci")
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(scripts, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// A worktree, where .git is a file
+	worktree := filepath.Join(tmp, "worktree")
+	if err := os.MkdirAll(filepath.Join(worktree, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(worktree, ".git"), []byte("gitdir: ../repo/.git/worktrees/w"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A plain directory outside any repository
+	plain := filepath.Join(tmp, "plain")
+	if err := os.MkdirAll(plain, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		workDir string
+		repo    bool
+		want    Layout
+	}{
+		{
+			name:    "nested directory mounts repo root",
+			workDir: scripts,
+			repo:    true,
+			want:    Layout{Root: repo, WorkDir: "/workspace/scripts/ci"},
+		},
+		{
+			name:    "repo root",
+			workDir: repo,
+			repo:    true,
+			want:    Layout{Root: repo, WorkDir: "/workspace"},
+		},
+		{
+			name:    "worktree",
+			workDir: filepath.Join(worktree, "sub"),
+			repo:    true,
+			want:    Layout{Root: worktree, WorkDir: "/workspace/sub"},
+		},
+		{
+			name:    "repo mounting disabled",
+			workDir: scripts,
+			repo:    false,
+			want:    Layout{Root: scripts, WorkDir: "/workspace"},
+		},
+		{
+			name:    "outside a repository",
+			workDir: plain,
+			repo:    true,
+			want:    Layout{Root: plain, WorkDir: "/workspace"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve(tt.workDir, tt.repo)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerPath(t *testing.T) {
+	l := Layout{Root: "/src/repo", WorkDir: "/workspace"}
+
+	tests := []struct {
+		hostPath string
+		want     string
+		wantOK   bool
+	}{
+		{hostPath: "/src/repo/scripts/build.sh", want: "/workspace/scripts/build.sh", wantOK: true},
+		{hostPath: "/src/repo", want: "/workspace", wantOK: true},
+		{hostPath: "/src/repo/..data/x", want: "/workspace/..data/x", wantOK: true},
+		{hostPath: "/src/other/build.sh"},
+		{hostPath: "/src"},
+	}
+
+	for _, tt := range tests {
+		got, ok := l.ContainerPath(tt.hostPath)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ContainerPath(%q) = %q, %v; want %q, %v", tt.hostPath, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}